@@ -1,24 +1,101 @@
 package main
 
+import "context"
+
 type ImageData struct {
-	Id          string  `json:"id"`
-	Name        string  `json:"tags"`
-	Source      string  `json:"source"`
-	SourceUrl   string  `json:"sourceUrl"`
-	Artist      string  `json:"artist"`
-	Aspect      float32 `json:"aspect"`
-	PreviewUrl  string  `json:"previewUrl"`
-	DownloadUrl string  `json:"downloadUrl"`
+	Id                  string      `json:"id"`
+	Name                string      `json:"tags"`
+	Source              string      `json:"source"`
+	SourceUrl           string      `json:"sourceUrl"`
+	Artist              string      `json:"artist"`
+	ArtistUrl           string      `json:"artistUrl,omitempty"`
+	Licence             string      `json:"licence,omitempty"`
+	LicenceUrl          string      `json:"licenceUrl,omitempty"`
+	Attribution         string      `json:"attribution,omitempty"`
+	AttributionHtml     string      `json:"attributionHtml,omitempty"`
+	AttributionMarkdown string      `json:"attributionMarkdown,omitempty"`
+	Aspect              float32     `json:"aspect"`
+	Width               int         `json:"width,omitempty"`
+	Height              int         `json:"height,omitempty"`
+	Color               string      `json:"color,omitempty"`
+	Blurhash            string      `json:"blurhash,omitempty"`
+	PreviewUrl          string      `json:"previewUrl"`
+	DownloadUrl         string      `json:"downloadUrl"`
+	UseUrl              string      `json:"useUrl,omitempty"`
+	Renditions          []Rendition `json:"renditions,omitempty"`
+	Alternates          []ImageData `json:"alternates,omitempty"`
+	DHash               string      `json:"-"`
+}
+
+// setSize sets the dimensions of the original image and its aspect, which is
+// left at zero rather than NaN or Inf when a provider reports no height
+func (img *ImageData) setSize(width float32, height float32) {
+	img.Width = int(width)
+	img.Height = int(height)
+	img.Aspect = 0
+	if width > 0 && height > 0 {
+		img.Aspect = width / height
+	}
+}
+
+// Rendition is one size of an image, renditions are listed smallest first
+type Rendition struct {
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Url    string `json:"url"`
+}
+
+// renditions drops the sizes a provider did not return a url for
+func renditions(sizes ...Rendition) []Rendition {
+	out := sizes[:0]
+	for _, size := range sizes {
+		if size.Url != "" {
+			out = append(out, size)
+		}
+	}
+	return out
+}
+
+// fitRendition is the size of a width x height image resized to fit within
+// maxWidth x maxHeight, a zero limit is unbounded. Images are never enlarged
+func fitRendition(url string, width float32, height float32, maxWidth float32, maxHeight float32) Rendition {
+	scale := float32(1)
+	if maxWidth > 0 && width*scale > maxWidth {
+		scale = maxWidth / width
+	}
+	if maxHeight > 0 && height*scale > maxHeight {
+		scale = maxHeight / height
+	}
+	return Rendition{
+		Width:  int(width*scale + 0.5),
+		Height: int(height*scale + 0.5),
+		Url:    url,
+	}
 }
 
 type ImageSearcher interface {
-	Search(page int, query string) ImageSearchResult
+	Search(ctx context.Context, page int, query string) ImageSearchResult
 	Type() string
 	TTL() int
 	PageSize() int
 }
 
+// UseTracker is implemented by searchers whose terms require telling them when
+// one of their images is used, Use returns the url to download the image from
+type UseTracker interface {
+	Use(ctx context.Context, id string) (string, error)
+}
+
+// useUrl is the proxy path a client requests when it uses an image, so the
+// provider can be told before the client is sent on to the image
+func useUrl(id string) string {
+	return "/use/" + id
+}
+
 type ImageSearchResult struct {
 	err    *error
 	images []ImageData
+	// raw and index are set by providers that drop results, see Found
+	raw   int
+	index []int
 }
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"sort"
+)
+
+type VideoData struct {
+	Id         string           `json:"id"`
+	Name       string           `json:"tags"`
+	Source     string           `json:"source"`
+	SourceUrl  string           `json:"sourceUrl"`
+	Artist     string           `json:"artist"`
+	ArtistUrl  string           `json:"artistUrl,omitempty"`
+	Duration   int              `json:"duration"`
+	Aspect     float32          `json:"aspect"`
+	PosterUrl  string           `json:"posterUrl"`
+	Renditions []VideoRendition `json:"renditions"`
+}
+
+// VideoRendition is one encoding of a video, Quality is the provider's own
+// label such as "hd" or "medium"
+type VideoRendition struct {
+	Quality  string `json:"quality,omitempty"`
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+	FileType string `json:"fileType"`
+	Size     int    `json:"size,omitempty"`
+	Url      string `json:"url"`
+}
+
+type VideoSearcher interface {
+	Search(ctx context.Context, page int, query string) VideoSearchResult
+	Type() string
+	TTL() int
+	PageSize() int
+}
+
+type VideoSearchResult struct {
+	err    *error
+	videos []VideoData
+}
+
+// sortRenditions orders renditions smallest first
+func sortRenditions(renditions []VideoRendition) {
+	sort.SliceStable(renditions, func(i, j int) bool {
+		return renditions[i].Width*renditions[i].Height < renditions[j].Width*renditions[j].Height
+	})
+}
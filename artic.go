@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+type ArticArtwork struct {
+	Id             int    `json:"id"`
+	Title          string `json:"title"`
+	ArtistTitle    string `json:"artist_title"`
+	ArtistId       int    `json:"artist_id"`
+	ImageId        string `json:"image_id"`
+	IsPublicDomain bool   `json:"is_public_domain"`
+	Thumbnail      struct {
+		Width   float32 `json:"width"`
+		Height  float32 `json:"height"`
+		AltText string  `json:"alt_text"`
+	} `json:"thumbnail"`
+}
+
+type ArticSearchResult struct {
+	Data   []ArticArtwork `json:"data"`
+	Config struct {
+		IiifUrl    string `json:"iiif_url"`
+		WebsiteUrl string `json:"website_url"`
+	} `json:"config"`
+}
+
+// ArticApi searches the Art Institute of Chicago public domain artworks,
+// images are served through their IIIF image API
+type ArticApi struct {
+	Http    *Upstream
+	cache   *ReqCache
+	baseUrl string
+}
+
+func NewArticApi(cfg *Config, cache *ReqCache) ArticApi {
+	return ArticApi{
+		Http:    NewUpstream("artic", cfg.Http.merge(cfg.Artic.Http)),
+		cache:   cache,
+		baseUrl: "https://api.artic.edu/api/v1/artworks/search",
+	}
+}
+
+func (api *ArticApi) Type() string {
+	return "artic"
+}
+
+func (api *ArticApi) TTL() int {
+	return 86400
+}
+
+func (api *ArticApi) PageSize() int { return 100 }
+
+func (api *ArticApi) Ping(ctx context.Context) error {
+	return pingUrl(ctx, api.Http, api.baseUrl)
+}
+
+func (api *ArticApi) Search(ctx context.Context, page int, query string) ImageSearchResult {
+	log := logFrom(ctx).With("provider", api.Type())
+	// search is limited to the first 1,000 results
+	if page*api.PageSize() > 1000 {
+		return ImageSearchResult{err: nil, images: []ImageData{}}
+	}
+	qParam := url.Values{}
+	qParam.Add("q", query)
+	qParam.Add("query[term][is_public_domain]", "true")
+	qParam.Add("fields", "id,title,artist_title,artist_id,image_id,is_public_domain,thumbnail")
+	qParam.Add("page", strconv.Itoa(page))
+	qParam.Add("limit", strconv.Itoa(api.PageSize()))
+	getReq, err := http.NewRequestWithContext(ctx, http.MethodGet, api.baseUrl+"?"+qParam.Encode(), nil)
+	if err != nil {
+		log.Error("Failed to create http request", "err", err)
+		return ImageSearchResult{err: &err, images: []ImageData{}}
+	}
+	getReq.Header.Set("AIC-User-Agent", projectUserAgent)
+	req, err := api.cache.CachedFetch(getReq, api.Http, api.TTL())
+	if err != nil {
+		log.Error("Failed to fetch", "err", err)
+		return ImageSearchResult{err: &err, images: []ImageData{}}
+	}
+	defer req.Body.Close()
+
+	data := ArticSearchResult{}
+	err = json.NewDecoder(req.Body).Decode(&data)
+	if err != nil {
+		log.Error("Failed to decode response", "err", err)
+		return ImageSearchResult{err: &err, images: []ImageData{}}
+	}
+	iiif := firstNonEmpty(data.Config.IiifUrl, "https://www.artic.edu/iiif/2")
+	website := firstNonEmpty(data.Config.WebsiteUrl, "https://www.artic.edu")
+	output := make([]ImageData, 0, len(data.Data))
+	index := make([]int, 0, len(data.Data))
+	for i, el := range data.Data {
+		if !el.IsPublicDomain || el.ImageId == "" {
+			continue
+		}
+		img := ImageData{
+			Id:          "artic/" + strconv.Itoa(el.Id),
+			Name:        el.Title,
+			Source:      "Art Institute of Chicago",
+			SourceUrl:   website + "/artworks/" + strconv.Itoa(el.Id),
+			Artist:      el.ArtistTitle,
+			Licence:     "CC0 1.0",
+			LicenceUrl:  "https://creativecommons.org/publicdomain/zero/1.0/",
+			PreviewUrl:  iiif + "/" + el.ImageId + "/full/843,/0/default.jpg",
+			DownloadUrl: iiif + "/" + el.ImageId + "/full/1686,/0/default.jpg",
+		}
+		if el.ArtistId != 0 {
+			img.ArtistUrl = website + "/artists/" + strconv.Itoa(el.ArtistId)
+		}
+		img.setSize(el.Thumbnail.Width, el.Thumbnail.Height)
+		output = append(output, img)
+		index = append(index, i)
+	}
+	return ImageSearchResult{err: nil, images: output, raw: len(data.Data), index: index}
+}
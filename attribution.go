@@ -0,0 +1,74 @@
+package main
+
+import (
+	"html"
+	"net/url"
+	"strings"
+)
+
+// attribute fills in the ready to use credits for img from its artist, source
+// and licence. A plain text attribution supplied by the provider is kept
+func attribute(img *ImageData) {
+	var text, htm, md strings.Builder
+	if img.Artist != "" {
+		text.WriteString("Photo by " + img.Artist + " on " + img.Source)
+		htm.WriteString("Photo by " + htmlLink(img.Artist, img.ArtistUrl) + " on " + htmlLink(img.Source, img.SourceUrl))
+		md.WriteString("Photo by " + markdownLink(img.Artist, img.ArtistUrl) + " on " + markdownLink(img.Source, img.SourceUrl))
+	} else {
+		text.WriteString("Photo from " + img.Source)
+		htm.WriteString("Photo from " + htmlLink(img.Source, img.SourceUrl))
+		md.WriteString("Photo from " + markdownLink(img.Source, img.SourceUrl))
+	}
+	if img.Licence != "" {
+		text.WriteString(", " + img.Licence)
+		htm.WriteString(", " + htmlLink(img.Licence, img.LicenceUrl))
+		md.WriteString(", " + markdownLink(img.Licence, img.LicenceUrl))
+	}
+	if img.Attribution == "" {
+		img.Attribution = text.String()
+	}
+	img.AttributionHtml = htm.String()
+	img.AttributionMarkdown = md.String()
+}
+
+// webLink reports whether link is an absolute http(s) URL, anything else
+// (javascript:, data: and so on) is left as plain text
+func webLink(link string) bool {
+	u, err := url.Parse(link)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	scheme := strings.ToLower(u.Scheme)
+	return scheme == "http" || scheme == "https"
+}
+
+func htmlLink(text string, link string) string {
+	if !webLink(link) {
+		return html.EscapeString(text)
+	}
+	return `<a href="` + html.EscapeString(link) + `">` + html.EscapeString(text) + `</a>`
+}
+
+var markdownEscaper = strings.NewReplacer(`\`, `\\`, `[`, `\[`, `]`, `\]`, `*`, `\*`, `_`, `\_`, "`", "\\`")
+
+func markdownLink(text string, link string) string {
+	if !webLink(link) {
+		return markdownEscaper.Replace(text)
+	}
+	link = strings.NewReplacer("(", "%28", ")", "%29", " ", "%20").Replace(link)
+	return "[" + markdownEscaper.Replace(text) + "](" + link + ")"
+}
+
+// utmUrl adds the referral parameters some providers ask for on links back to
+// their site
+func utmUrl(link string, source string) string {
+	u, err := url.Parse(link)
+	if err != nil || link == "" {
+		return link
+	}
+	q := u.Query()
+	q.Set("utm_source", source)
+	q.Set("utm_medium", "referral")
+	u.RawQuery = q.Encode()
+	return u.String()
+}
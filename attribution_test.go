@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAttribute(t *testing.T) {
+	img := ImageData{
+		Source:     "Unsplash",
+		SourceUrl:  utmUrl("https://unsplash.com/photos/abc", "picker"),
+		Artist:     "Jo <Smith> [work]",
+		ArtistUrl:  utmUrl("https://unsplash.com/@jo", "picker"),
+		Licence:    "Unsplash License",
+		LicenceUrl: "https://unsplash.com/license",
+	}
+	attribute(&img)
+	assert.Equal(t, "Photo by Jo <Smith> [work] on Unsplash, Unsplash License", img.Attribution)
+	assert.Equal(t, `Photo by <a href="https://unsplash.com/@jo?utm_medium=referral&amp;utm_source=picker">Jo &lt;Smith&gt; [work]</a>`+
+		` on <a href="https://unsplash.com/photos/abc?utm_medium=referral&amp;utm_source=picker">Unsplash</a>`+
+		`, <a href="https://unsplash.com/license">Unsplash License</a>`, img.AttributionHtml)
+	assert.Equal(t, `Photo by [Jo <Smith> \[work\]](https://unsplash.com/@jo?utm_medium=referral&utm_source=picker)`+
+		` on [Unsplash](https://unsplash.com/photos/abc?utm_medium=referral&utm_source=picker)`+
+		`, [Unsplash License](https://unsplash.com/license)`, img.AttributionMarkdown)
+
+	img = ImageData{
+		Source:      "Openverse",
+		SourceUrl:   "https://example.com/photo_(1)",
+		Attribution: "\"Photo\" by someone is licensed under CC BY 2.0.",
+	}
+	attribute(&img)
+	assert.Equal(t, "\"Photo\" by someone is licensed under CC BY 2.0.", img.Attribution, "Provider attribution is kept")
+	assert.Equal(t, `Photo from <a href="https://example.com/photo_(1)">Openverse</a>`, img.AttributionHtml)
+	assert.Equal(t, `Photo from [Openverse](https://example.com/photo_%281%29)`, img.AttributionMarkdown)
+
+	img = ImageData{
+		Source:     "Example",
+		SourceUrl:  "javascript:alert(1)",
+		Artist:     "Jo",
+		ArtistUrl:  "//example.com/jo",
+		Licence:    "CC0",
+		LicenceUrl: "HTTPS://creativecommons.org/publicdomain/zero/1.0/",
+	}
+	attribute(&img)
+	assert.Equal(t, `Photo by Jo on Example, <a href="HTTPS://creativecommons.org/publicdomain/zero/1.0/">CC0</a>`, img.AttributionHtml,
+		"Only http(s) URLs become links")
+	assert.Equal(t, `Photo by Jo on Example, [CC0](HTTPS://creativecommons.org/publicdomain/zero/1.0/)`, img.AttributionMarkdown)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"strings"
+)
+
+// blurhashSample is the longest side images are sampled down to before
+// encoding, a blurhash only keeps a handful of components so this loses nothing
+const blurhashSample int = 64
+
+const base83Chars string = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+// linearPixels samples img down to at most blurhashSample pixels on its
+// longest side, converting each pixel to linear RGB
+func linearPixels(img image.Image) ([][3]float64, int, int) {
+	bounds := img.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+	w, h := srcW, srcH
+	if w > blurhashSample || h > blurhashSample {
+		if w >= h {
+			w, h = blurhashSample, max(1, srcH*blurhashSample/srcW)
+		} else {
+			w, h = max(1, srcW*blurhashSample/srcH), blurhashSample
+		}
+	}
+	pixels := make([][3]float64, 0, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			r, g, b, _ := img.At(bounds.Min.X+x*srcW/w, bounds.Min.Y+y*srcH/h).RGBA()
+			pixels = append(pixels, [3]float64{
+				srgbToLinear(int(r >> 8)),
+				srgbToLinear(int(g >> 8)),
+				srgbToLinear(int(b >> 8)),
+			})
+		}
+	}
+	return pixels, w, h
+}
+
+// averageColor is the mean colour of img as a #rrggbb hex string
+func averageColor(img image.Image) string {
+	pixels, _, _ := linearPixels(img)
+	var sum [3]float64
+	for _, p := range pixels {
+		sum[0] += p[0]
+		sum[1] += p[1]
+		sum[2] += p[2]
+	}
+	n := float64(max(1, len(pixels)))
+	return fmt.Sprintf("#%02x%02x%02x", linearToSrgb(sum[0]/n), linearToSrgb(sum[1]/n), linearToSrgb(sum[2]/n))
+}
+
+// encodeBlurhash encodes img as a blurhash (https://blurha.sh) with 4
+// components along the longest side and 3 along the other
+func encodeBlurhash(img image.Image) string {
+	pixels, w, h := linearPixels(img)
+	xComp, yComp := 4, 3
+	if h > w {
+		xComp, yComp = 3, 4
+	}
+	factors := make([][3]float64, 0, xComp*yComp)
+	for j := 0; j < yComp; j++ {
+		for i := 0; i < xComp; i++ {
+			norm := 2.0
+			if i == 0 && j == 0 {
+				norm = 1
+			}
+			var f [3]float64
+			for y := 0; y < h; y++ {
+				for x := 0; x < w; x++ {
+					basis := norm * math.Cos(math.Pi*float64(i*x)/float64(w)) * math.Cos(math.Pi*float64(j*y)/float64(h))
+					p := pixels[y*w+x]
+					f[0] += basis * p[0]
+					f[1] += basis * p[1]
+					f[2] += basis * p[2]
+				}
+			}
+			scale := 1 / float64(w*h)
+			factors = append(factors, [3]float64{f[0] * scale, f[1] * scale, f[2] * scale})
+		}
+	}
+
+	var hash strings.Builder
+	hash.WriteString(encode83((xComp-1)+(yComp-1)*9, 1))
+	maxValue := 1.0
+	if len(factors) > 1 {
+		actualMax := 0.0
+		for _, f := range factors[1:] {
+			actualMax = math.Max(actualMax, math.Max(math.Abs(f[0]), math.Max(math.Abs(f[1]), math.Abs(f[2]))))
+		}
+		quantisedMax := int(math.Max(0, math.Min(82, math.Floor(actualMax*166-0.5))))
+		maxValue = float64(quantisedMax+1) / 166
+		hash.WriteString(encode83(quantisedMax, 1))
+	} else {
+		hash.WriteString(encode83(0, 1))
+	}
+	dc := factors[0]
+	hash.WriteString(encode83(linearToSrgb(dc[0])<<16+linearToSrgb(dc[1])<<8+linearToSrgb(dc[2]), 4))
+	for _, f := range factors[1:] {
+		quant := func(v float64) int {
+			return int(math.Max(0, math.Min(18, math.Floor(signPow(v/maxValue, 0.5)*9+9.5))))
+		}
+		hash.WriteString(encode83(quant(f[0])*19*19+quant(f[1])*19+quant(f[2]), 2))
+	}
+	return hash.String()
+}
+
+func encode83(value int, length int) string {
+	out := make([]byte, length)
+	for i := length - 1; i >= 0; i-- {
+		out[i] = base83Chars[value%83]
+		value /= 83
+	}
+	return string(out)
+}
+
+func srgbToLinear(value int) float64 {
+	v := float64(value) / 255
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func linearToSrgb(value float64) int {
+	v := math.Max(0, math.Min(1, value))
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+func signPow(value float64, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(value), exp), value)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeBlurhash(t *testing.T) {
+	solid := image.NewRGBA(image.Rect(0, 0, 300, 200))
+	for y := 0; y < 200; y++ {
+		for x := 0; x < 300; x++ {
+			solid.Set(x, y, color.RGBA{255, 0, 0, 255})
+		}
+	}
+	hash := encodeBlurhash(solid)
+	assert.Equal(t, 28, len(hash), "4x3 components")
+	assert.Equal(t, "L", hash[:1], "4x3 components for landscape images")
+	assert.Equal(t, encode83(0xff0000, 4), hash[2:6], "DC is the average colour")
+	assert.Equal(t, hash, encodeBlurhash(solid))
+	assert.Equal(t, "#ff0000", averageColor(solid))
+
+	tall := image.NewGray(image.Rect(0, 0, 100, 400))
+	for y := 0; y < 400; y++ {
+		for x := 0; x < 100; x++ {
+			tall.Set(x, y, color.Gray{uint8(y * 255 / 399)})
+		}
+	}
+	hash = encodeBlurhash(tall)
+	assert.Equal(t, 28, len(hash))
+	assert.Equal(t, "T", hash[:1], "3x4 components for portrait images")
+	assert.Equal(t, encode83(0x959595, 4), hash[2:6])
+	assert.Equal(t, "#959595", averageColor(tall), "Averaged in linear light, lighter than the #7f7f7f sRGB mean")
+}
+
+func TestEncode83(t *testing.T) {
+	assert.Equal(t, "00", encode83(0, 2))
+	assert.Equal(t, "~", encode83(82, 1))
+	assert.Equal(t, "10", encode83(83, 2))
+}
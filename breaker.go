@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+type BreakerConfig struct {
+	Failures int      `json:"failures"`
+	CoolDown Duration `json:"coolDown"`
+	Probes   int      `json:"probes"`
+}
+
+type BreakerState int
+
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "closed"
+}
+
+// Breaker stops calls to a provider after a run of consecutive failures. Once
+// the cool down has passed a limited number of probe searches are let through,
+// and the breaker closes again when they succeed
+type Breaker struct {
+	mu        sync.Mutex
+	name      string
+	cfg       BreakerConfig
+	state     BreakerState
+	failures  int
+	openedAt  time.Time
+	probes    int
+	successes int
+}
+
+// NewBreaker clamps failures and probes to at least one, with no probes a
+// half-open breaker would never close again
+func NewBreaker(name string, cfg BreakerConfig) *Breaker {
+	cfg.Failures = max(cfg.Failures, 1)
+	cfg.Probes = max(cfg.Probes, 1)
+	b := &Breaker{name: name, cfg: cfg}
+	circuitState.WithLabelValues(name).Set(float64(BreakerClosed))
+	return b
+}
+
+func (b *Breaker) setState(state BreakerState) {
+	b.state = state
+	b.probes = 0
+	b.successes = 0
+	circuitState.WithLabelValues(b.name).Set(float64(state))
+	slog.Info("Circuit breaker changed state", "provider", b.name, "state", state.String())
+}
+
+// Allow reports whether a search may be sent to the provider, every allowed
+// call must be followed by Success, Failure or Cancel
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.cfg.CoolDown.Std() {
+			return false
+		}
+		b.setState(BreakerHalfOpen)
+		fallthrough
+	case BreakerHalfOpen:
+		if b.probes >= b.cfg.Probes {
+			return false
+		}
+		b.probes++
+	}
+	return true
+}
+
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerClosed:
+		b.failures = 0
+	case BreakerHalfOpen:
+		b.successes++
+		if b.successes >= b.cfg.Probes {
+			b.failures = 0
+			b.setState(BreakerClosed)
+		}
+	}
+}
+
+func (b *Breaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerClosed:
+		b.failures++
+		if b.failures >= b.cfg.Failures {
+			b.openedAt = time.Now()
+			b.setState(BreakerOpen)
+		}
+	case BreakerHalfOpen:
+		b.openedAt = time.Now()
+		b.setState(BreakerOpen)
+	}
+}
+
+// Cancel releases an allowed call that ended without telling us anything
+// about the provider, such as the client going away
+func (b *Breaker) Cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerHalfOpen && b.probes > 0 {
+		b.probes--
+	}
+}
+
+// Record passes the outcome of a search to the breaker, searches skipped
+// because of the rate limit say nothing about the health of the provider
+func (b *Breaker) Record(err error) {
+	var quotaErr *QuotaError
+	switch {
+	case err == nil:
+		b.Success()
+	case errors.Is(err, context.Canceled), errors.As(err, &quotaErr):
+		b.Cancel()
+	default:
+		b.Failure()
+	}
+}
+
+func (b *Breaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// Breakers holds the circuit breaker for each provider, keyed by Type()
+type Breakers map[string]*Breaker
+
+func NewBreakers[S Searcher](cfg *Config, apis []S) Breakers {
+	breakers := Breakers{}
+	for _, api := range apis {
+		breakers[api.Type()] = NewBreaker(api.Type(), cfg.Breaker)
+	}
+	return breakers
+}
+
+func (bs Breakers) States() map[string]string {
+	states := make(map[string]string, len(bs))
+	for name, b := range bs {
+		states[name] = b.State().String()
+	}
+	return states
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBreaker(t *testing.T) {
+	b := NewBreaker("test", BreakerConfig{Failures: 2, CoolDown: Duration(20 * time.Millisecond), Probes: 1})
+	fail := errors.New("upstream failed")
+
+	assert.True(t, b.Allow())
+	b.Record(fail)
+	assert.Equal(t, BreakerClosed, b.State())
+	assert.True(t, b.Allow())
+	b.Record(fail)
+	assert.Equal(t, BreakerOpen, b.State())
+	assert.False(t, b.Allow(), "Open breaker rejects calls")
+
+	time.Sleep(25 * time.Millisecond)
+	assert.True(t, b.Allow(), "Probe allowed after cool down")
+	assert.Equal(t, BreakerHalfOpen, b.State())
+	assert.False(t, b.Allow(), "Only one probe at a time")
+	b.Record(fail)
+	assert.Equal(t, BreakerOpen, b.State(), "Failed probe reopens")
+
+	time.Sleep(25 * time.Millisecond)
+	assert.True(t, b.Allow())
+	b.Record(context.Canceled)
+	assert.Equal(t, BreakerHalfOpen, b.State(), "Cancelled probe is ignored")
+	assert.True(t, b.Allow())
+	b.Record(nil)
+	assert.Equal(t, BreakerClosed, b.State())
+}
+
+func TestBreakerZeroProbes(t *testing.T) {
+	b := NewBreaker("test", BreakerConfig{Failures: 0, CoolDown: Duration(time.Millisecond), Probes: 0})
+	b.Record(errors.New("upstream failed"))
+	assert.Equal(t, BreakerOpen, b.State())
+
+	time.Sleep(5 * time.Millisecond)
+	assert.True(t, b.Allow(), "A probe is allowed with probes set to 0")
+	b.Record(nil)
+	assert.Equal(t, BreakerClosed, b.State())
+}
+
+func TestBreakerSearchDeadline(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.Breaker = BreakerConfig{Failures: 2, CoolDown: Duration(time.Minute), Probes: 1}
+	slow := &fakeSearcher{name: "slow", pageSize: 10, total: 10, delay: 50 * time.Millisecond}
+	breakers := NewBreakers(&cfg, []*fakeSearcher{slow})
+	handler := searchHandler(&cfg, []*fakeSearcher{slow}, breakers,
+		func(ctx context.Context, api *fakeSearcher, page int, query string) Found[string] {
+			return fakeSearch(ctx, api, page)
+		}, nil)
+
+	for i := 0; i < 5; i++ {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, "/search?q=cat&timeout=1ms", nil))
+		assert.Equal(t, "slow=timeout", rec.Header().Get(providerStatusHeader))
+	}
+	assert.Equal(t, BreakerClosed, breakers["slow"].State(), "A short client timeout never opens the breaker")
+
+	// the upstream client's own timeout ends the search before the deadline,
+	// a new searcher as the timed out searches may still be running
+	timedOut := &fakeSearcher{name: "slow", pageSize: 10, err: context.DeadlineExceeded}
+	handler = searchHandler(&cfg, []*fakeSearcher{timedOut}, breakers,
+		func(ctx context.Context, api *fakeSearcher, page int, query string) Found[string] {
+			return fakeSearch(ctx, api, page)
+		}, nil)
+	for i := 0; i < 2; i++ {
+		handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/search?q=cat", nil))
+	}
+	assert.Equal(t, BreakerOpen, breakers["slow"].State(), "Upstream timeouts are failures")
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+)
+
+type Config struct {
+	Pexels struct {
+		Key  KeyList    `json:"key"`
+		Http HttpConfig `json:"http"`
+	} `json:"pexels.com"`
+	Unsplash struct {
+		AccessKey KeyList    `json:"access"`
+		SecretKey string     `json:"secret"`
+		AppName   string     `json:"appName"`
+		Http      HttpConfig `json:"http"`
+	} `json:"unsplash.com"`
+	Pixabay struct {
+		Key  KeyList    `json:"key"`
+		Http HttpConfig `json:"http"`
+	} `json:"pixabay.com"`
+	Openverse struct {
+		Enabled     bool       `json:"enabled"`
+		LicenseType string     `json:"licenseType"`
+		Http        HttpConfig `json:"http"`
+	} `json:"openverse.org"`
+	Wikimedia struct {
+		Disabled  bool       `json:"disabled"`
+		UserAgent string     `json:"userAgent"`
+		Http      HttpConfig `json:"http"`
+	} `json:"commons.wikimedia.org"`
+	Flickr struct {
+		Key     KeyList    `json:"key"`
+		PerPage int        `json:"perPage"`
+		Http    HttpConfig `json:"http"`
+	} `json:"flickr.com"`
+	Met struct {
+		Enabled     bool       `json:"enabled"`
+		Concurrency int        `json:"concurrency"`
+		Http        HttpConfig `json:"http"`
+	} `json:"metmuseum.org"`
+	Artic struct {
+		Enabled bool       `json:"enabled"`
+		Http    HttpConfig `json:"http"`
+	} `json:"artic.edu"`
+	Rijksmuseum struct {
+		Key  KeyList    `json:"key"`
+		Http HttpConfig `json:"http"`
+	} `json:"rijksmuseum.nl"`
+	Providers []GenericConfig `json:"providers"`
+	Library   struct {
+		Dir        string   `json:"dir"`
+		Url        string   `json:"url"`
+		PreviewUrl string   `json:"previewUrl"`
+		PreviewDir string   `json:"previewDir"`
+		Name       string   `json:"name"`
+		Artist     string   `json:"artist"`
+		Licence    string   `json:"licence"`
+		LicenceUrl string   `json:"licenceUrl"`
+		Rescan     Duration `json:"rescan"`
+		Auth       bool     `json:"auth"`
+	} `json:"library"`
+	ImageMeta struct {
+		Disabled bool `json:"disabled"`
+		Workers  int  `json:"workers"`
+		Queue    int  `json:"queue"`
+	} `json:"imageMeta"`
+	Http    HttpConfig    `json:"http"`
+	Breaker BreakerConfig `json:"breaker"`
+	Search  struct {
+		Timeout    Duration           `json:"timeout"`
+		MaxTimeout Duration           `json:"maxTimeout"`
+		PerPage    int                `json:"perPage"`
+		MaxPerPage int                `json:"maxPerPage"`
+		CursorKey  string             `json:"cursorKey"`
+		Rank       string             `json:"rank"`
+		Weights    map[string]float64 `json:"weights"`
+		Dedupe     struct {
+			Disabled bool `json:"disabled"`
+			Distance int  `json:"distance"`
+		} `json:"dedupe"`
+	} `json:"search"`
+	Debug struct {
+		PrettyJson bool `json:"prettyJson"`
+	}
+	Database string       `json:"database"`
+	Listen   ListenConfig `json:"listen"`
+	Health   struct {
+		CheckProviders bool     `json:"checkProviders"`
+		Timeout        Duration `json:"timeout"`
+	} `json:"health"`
+	Metrics struct {
+		Auth bool `json:"auth"`
+	} `json:"metrics"`
+	Log struct {
+		Format string `json:"format"`
+		Level  string `json:"level"`
+	} `json:"log"`
+}
+
+// ListenConfig selects which servers are started, an empty address disables
+// that server
+type ListenConfig struct {
+	Http  string `json:"http"`
+	Https struct {
+		Addr string `json:"addr"`
+		Cert string `json:"cert"`
+		Key  string `json:"key"`
+	} `json:"https"`
+	FastCGI struct {
+		Network string `json:"network"`
+		Addr    string `json:"addr"`
+		Mode    string `json:"mode"`
+	} `json:"fastcgi"`
+	DrainDelay      Duration `json:"drainDelay"`
+	ShutdownTimeout Duration `json:"shutdownTimeout"`
+}
+
+// Duration reads either a Go duration string ("1m30s") or a number of seconds
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	switch value := v.(type) {
+	case float64:
+		*d = Duration(value * float64(time.Second))
+	case string:
+		dur, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		*d = Duration(dur)
+	default:
+		return fmt.Errorf("invalid duration %s", string(b))
+	}
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d Duration) Std() time.Duration {
+	return time.Duration(d)
+}
+
+const configFile string = "conf/config.json"
+
+func defaultConfig() Config {
+	cfg := Config{}
+	cfg.Unsplash.AppName = "stockimgproxy"
+	cfg.Openverse.LicenseType = "commercial"
+	cfg.ImageMeta.Workers = 2
+	cfg.ImageMeta.Queue = 1000
+	cfg.Search.PerPage = PageSize
+	cfg.Search.MaxPerPage = 100
+	cfg.Search.Rank = rankRoundRobin
+	cfg.Search.Dedupe.Distance = 6
+	cfg.Library.Url = "/library/"
+	cfg.Library.PreviewUrl = "/library-previews/"
+	cfg.Library.Name = "Library"
+	cfg.Library.Rescan = Duration(5 * time.Minute)
+	cfg.Listen.Http = ":8081"
+	cfg.Listen.FastCGI.Network = "unix"
+	cfg.Listen.FastCGI.Addr = "sock/fcgi.sock"
+	cfg.Listen.FastCGI.Mode = "0777"
+	cfg.Listen.DrainDelay = Duration(5 * time.Second)
+	cfg.Listen.ShutdownTimeout = Duration(30 * time.Second)
+	cfg.Health.Timeout = Duration(5 * time.Second)
+	cfg.Search.Timeout = Duration(10 * time.Second)
+	cfg.Breaker = BreakerConfig{
+		Failures: 5,
+		CoolDown: Duration(1 * time.Minute),
+		Probes:   1,
+	}
+	cfg.Search.MaxTimeout = Duration(30 * time.Second)
+	cfg.Http = HttpConfig{
+		Timeout:        Duration(15 * time.Second),
+		ConnectTimeout: Duration(5 * time.Second),
+		Retries:        2,
+		RetryWait:      Duration(250 * time.Millisecond),
+		RetryMaxWait:   Duration(5 * time.Second),
+		QuotaReserve:   5,
+	}
+	return cfg
+}
+
+func processError(err error) {
+	fmt.Println(err.Error())
+	os.Exit(2)
+}
+
+// parseFlags loads the configuration file named by -config, then applies any
+// listener flags given on the command line over the top of it
+func parseFlags(cfg *Config) {
+	path := flag.String("config", configFile, "Configuration file")
+	listen := ListenConfig{}
+	flag.StringVar(&listen.Http, "http", "", "HTTP listen address, empty to disable")
+	flag.StringVar(&listen.Https.Addr, "https", "", "HTTPS listen address, empty to disable")
+	flag.StringVar(&listen.Https.Cert, "tls-cert", "", "TLS certificate file")
+	flag.StringVar(&listen.Https.Key, "tls-key", "", "TLS private key file")
+	flag.StringVar(&listen.FastCGI.Network, "fcgi-network", "", "FastCGI network, unix or tcp")
+	flag.StringVar(&listen.FastCGI.Addr, "fcgi", "", "FastCGI socket path or tcp address, empty to disable")
+	flag.StringVar(&listen.FastCGI.Mode, "fcgi-mode", "", "FastCGI unix socket permissions (octal)")
+	flag.Parse()
+
+	loadConfig(*path, cfg)
+
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "http":
+			cfg.Listen.Http = listen.Http
+		case "https":
+			cfg.Listen.Https.Addr = listen.Https.Addr
+		case "tls-cert":
+			cfg.Listen.Https.Cert = listen.Https.Cert
+		case "tls-key":
+			cfg.Listen.Https.Key = listen.Https.Key
+		case "fcgi-network":
+			cfg.Listen.FastCGI.Network = listen.FastCGI.Network
+		case "fcgi":
+			cfg.Listen.FastCGI.Addr = listen.FastCGI.Addr
+		case "fcgi-mode":
+			cfg.Listen.FastCGI.Mode = listen.FastCGI.Mode
+		}
+	})
+}
+
+func loadConfig(path string, cfg *Config) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		processError(err)
+	}
+	defer f.Close()
+
+	decoder := json.NewDecoder(f)
+	switch err := decoder.Decode(&cfg).(type) {
+	case *json.SyntaxError:
+		f.Seek(0, io.SeekStart)
+		pos := findPos(bufio.NewReader(f), int(err.Offset))
+		log.Panicf("Unable to decode configuration file (Line: %d, Pos: %d); - %v\n", pos.line, pos.pos, err.Error())
+	}
+}
+
+type FilePos struct {
+	line int
+	pos  int
+}
+
+func findPos(file *bufio.Reader, offset int) FilePos {
+	p := FilePos{line: 1, pos: offset}
+	var lineLen int
+	for line, err := file.ReadBytes('\n'); len(line) > 0 && err == nil; line, err = file.ReadBytes('\n') {
+		if p.pos < len(line) {
+			return p
+		}
+		lineLen += len(line)
+		if line[len(line)-1] == '\n' {
+			p.line += 1
+			p.pos -= lineLen
+			lineLen = 0
+		}
+	}
+	return p
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// Cursor is the position reached in each provider's results. Providers that
+// have returned all their results are left out
+type Cursor struct {
+	Query   string         `json:"q"`
+	Offsets map[string]int `json:"o"`
+}
+
+const nextCursorHeader string = "X-Next-Cursor"
+
+var errInvalidCursor = errors.New("cursor is invalid or has been modified")
+
+// newCursorKey is used to sign cursors when search.cursorKey is not set, so
+// cursors do not survive a restart and are not shared between instances
+func newCursorKey() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// encodeCursor signs c with key, the result is safe to use in a url
+func encodeCursor(key string, c Cursor) string {
+	payload, _ := json.Marshal(c)
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString(payload) + "." + enc.EncodeToString(cursorMac(key, payload))
+}
+
+// decodeCursor checks the signature of a cursor made by encodeCursor
+func decodeCursor(key string, value string) (Cursor, error) {
+	var c Cursor
+	enc := base64.RawURLEncoding
+	data, sig, found := strings.Cut(value, ".")
+	if !found {
+		return c, errInvalidCursor
+	}
+	payload, err := enc.DecodeString(data)
+	if err != nil {
+		return c, errInvalidCursor
+	}
+	mac, err := enc.DecodeString(sig)
+	if err != nil || !hmac.Equal(mac, cursorMac(key, payload)) {
+		return c, errInvalidCursor
+	}
+	if err := json.Unmarshal(payload, &c); err != nil || c.Offsets == nil {
+		return c, errInvalidCursor
+	}
+	return c, nil
+}
+
+func cursorMac(key string, payload []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCursor(t *testing.T) {
+	cursor := Cursor{Query: "cat", Offsets: map[string]int{"pexels": 25, "unsplash": 12}}
+	value := encodeCursor("secret", cursor)
+	decoded, err := decodeCursor("secret", value)
+	assert.NoError(t, err)
+	assert.Equal(t, cursor, decoded)
+
+	_, err = decodeCursor("other", value)
+	assert.Equal(t, errInvalidCursor, err, "Signed with another key")
+	data, sig, _ := strings.Cut(value, ".")
+	payload, _ := json.Marshal(Cursor{Query: "cat", Offsets: map[string]int{"pexels": 0}})
+	forged := base64.RawURLEncoding.EncodeToString(payload)
+	for _, bad := range []string{"", data, forged + "." + sig, "!!." + sig, data + ".!!"} {
+		_, err = decodeCursor("secret", bad)
+		assert.Equal(t, errInvalidCursor, err, bad)
+	}
+}
+
+func TestCursorPaging(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.Search.CursorKey = "secret"
+	flaky := &fakeSearcher{name: "flaky", pageSize: 10, total: 30}
+	apis := []*fakeSearcher{
+		{name: "a", pageSize: 7, total: 12},
+		{name: "b", pageSize: 30, total: 45},
+		flaky,
+	}
+	handler := searchHandler(&cfg, apis, NewBreakers(&cfg, apis),
+		func(ctx context.Context, api *fakeSearcher, page int, query string) Found[string] {
+			return fakeSearch(ctx, api, page)
+		}, nil)
+
+	seen := map[string]int{}
+	target := "/search?q=cat&per_page=5"
+	for pages := 0; target != ""; pages++ {
+		assert.Less(t, pages, 20)
+		flaky.err = nil
+		if pages == 1 {
+			flaky.err = errors.New("down")
+		}
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		var results []string
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &results))
+		for _, item := range results {
+			seen[item]++
+		}
+		target = ""
+		if link := rec.Header().Get("Link"); link != "" {
+			assert.Contains(t, link, "cursor="+url.QueryEscape(rec.Header().Get(nextCursorHeader)))
+			target = strings.TrimSuffix(strings.TrimPrefix(link, "<"), `>; rel="next"`)
+		}
+	}
+	assert.Equal(t, 12+45+30, len(seen), "Results missed while a provider failed are returned later")
+	for item, n := range seen {
+		assert.Equal(t, 1, n, item)
+	}
+
+	cursor := encodeCursor("secret", Cursor{Query: "dog", Offsets: map[string]int{"a": 5}})
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/search?q=cat&cursor="+cursor, nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code, "Cursor for another query")
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/search?q=cat&page=2&per_page=5", nil))
+	next, err := decodeCursor("secret", rec.Header().Get(nextCursorHeader))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"a": 10, "b": 10, "flaky": 10}, next.Offsets, "Pages return a cursor too")
+}
+
+func TestCursorFiltered(t *testing.T) {
+	cfg := defaultConfig()
+	apis := []*fakeSearcher{
+		{name: "met", pageSize: 30, total: 200, drop: 5},
+		{name: "a", pageSize: 10, total: 40},
+	}
+	breakers := NewBreakers(&cfg, apis)
+	query := &QueryParams{PerPage: 25, Page: 1}
+	res := searchAll(context.Background(), query, apis, breakers, fakeSearch)
+	assert.Equal(t, []int{25, 25}, res.Next, "Offsets count dropped results too")
+	assert.Equal(t, 20+25, len(res.Results()))
+
+	seen := map[string]int{}
+	for pages := 0; ; pages++ {
+		assert.Less(t, pages, 20)
+		for _, item := range res.Results() {
+			seen[item]++
+		}
+		cursor := Cursor{Offsets: map[string]int{}}
+		var active []*fakeSearcher
+		for num, api := range apis {
+			if res.Next[num] >= 0 {
+				cursor.Offsets[api.name] = res.Next[num]
+				active = append(active, api)
+			}
+		}
+		if len(active) == 0 {
+			break
+		}
+		query.Cursor = &cursor
+		res = searchAll(context.Background(), query, active, breakers, fakeSearch)
+		apis = active
+	}
+	assert.Equal(t, 160+40, len(seen), "Every kept result is returned")
+	for item, n := range seen {
+		assert.Equal(t, 1, n, item)
+	}
+}
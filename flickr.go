@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// flickrInt reads numbers Flickr sends either as JSON numbers or strings
+type flickrInt int
+
+func (n *flickrInt) UnmarshalJSON(b []byte) error {
+	s := strings.Trim(string(b), `"`)
+	if s == "" || s == "null" {
+		*n = 0
+		return nil
+	}
+	v, err := strconv.Atoi(s)
+	*n = flickrInt(v)
+	return err
+}
+
+type FlickrPhoto struct {
+	Id        string    `json:"id"`
+	Owner     string    `json:"owner"`
+	Title     string    `json:"title"`
+	License   string    `json:"license"`
+	OwnerName string    `json:"ownername"`
+	Tags      string    `json:"tags"`
+	UrlM      string    `json:"url_m"`
+	UrlZ      string    `json:"url_z"`
+	UrlC      string    `json:"url_c"`
+	UrlL      string    `json:"url_l"`
+	WidthL    flickrInt `json:"width_l"`
+	HeightL   flickrInt `json:"height_l"`
+	UrlO      string    `json:"url_o"`
+	WidthO    flickrInt `json:"width_o"`
+	HeightO   flickrInt `json:"height_o"`
+	WidthM    flickrInt `json:"width_m"`
+	HeightM   flickrInt `json:"height_m"`
+}
+
+type FlickrSearchResult struct {
+	Photos struct {
+		Page    int           `json:"page"`
+		Pages   int           `json:"pages"`
+		PerPage int           `json:"perpage"`
+		Photo   []FlickrPhoto `json:"photo"`
+	} `json:"photos"`
+	Stat    string `json:"stat"`
+	Message string `json:"message"`
+}
+
+type flickrLicence struct {
+	Name string
+	Url  string
+}
+
+// flickrLicences are the licences that allow commercial use, only photos under
+// one of these are searched
+var flickrLicences = map[string]flickrLicence{
+	"4":  {"CC BY 2.0", "https://creativecommons.org/licenses/by/2.0/"},
+	"5":  {"CC BY-SA 2.0", "https://creativecommons.org/licenses/by-sa/2.0/"},
+	"7":  {"No known copyright restrictions", "https://www.flickr.com/commons/usage/"},
+	"8":  {"United States Government Work", "http://www.usa.gov/copyright.shtml"},
+	"9":  {"CC0 1.0", "https://creativecommons.org/publicdomain/zero/1.0/"},
+	"10": {"Public Domain Mark 1.0", "https://creativecommons.org/publicdomain/mark/1.0/"},
+	"11": {"CC BY 4.0", "https://creativecommons.org/licenses/by/4.0/"},
+	"12": {"CC BY-SA 4.0", "https://creativecommons.org/licenses/by-sa/4.0/"},
+}
+
+const flickrLicenceIds string = "4,5,7,8,9,10,11,12"
+
+type FlickrApi struct {
+	Http    *Upstream
+	cache   *ReqCache
+	baseUrl string
+	perPage int
+}
+
+func NewFlickrApi(cfg *Config, cache *ReqCache) FlickrApi {
+	perPage := cfg.Flickr.PerPage
+	if perPage <= 0 || perPage > 500 {
+		perPage = 500
+	}
+	return FlickrApi{
+		Http: NewUpstream("flickr", cfg.Http.merge(cfg.Flickr.Http)).WithKeys(cfg.Flickr.Key,
+			func(req *http.Request, key string) {
+				q := req.URL.Query()
+				q.Set("api_key", key)
+				req.URL.RawQuery = q.Encode()
+			}),
+		cache:   cache,
+		baseUrl: "https://www.flickr.com/services/rest/",
+		perPage: perPage,
+	}
+}
+
+func (api *FlickrApi) Type() string {
+	return "flickr"
+}
+
+func (api *FlickrApi) TTL() int {
+	return 86400
+}
+
+func (api *FlickrApi) PageSize() int { return api.perPage }
+
+func (api *FlickrApi) Ping(ctx context.Context) error {
+	return pingUrl(ctx, api.Http, api.baseUrl)
+}
+
+func (api *FlickrApi) Search(ctx context.Context, page int, query string) ImageSearchResult {
+	log := logFrom(ctx).With("provider", api.Type())
+	qParam := url.Values{}
+	qParam.Add("method", "flickr.photos.search")
+	qParam.Add("format", "json")
+	qParam.Add("nojsoncallback", "1")
+	qParam.Add("text", query)
+	qParam.Add("license", flickrLicenceIds)
+	qParam.Add("media", "photos")
+	qParam.Add("content_type", "1")
+	qParam.Add("safe_search", "1")
+	qParam.Add("sort", "relevance")
+	qParam.Add("extras", "url_m,url_z,url_c,url_l,url_o,owner_name,license,tags")
+	qParam.Add("page", strconv.Itoa(page))
+	qParam.Add("per_page", strconv.Itoa(api.PageSize()))
+	getReq, err := http.NewRequestWithContext(ctx, http.MethodGet, api.baseUrl+"?"+qParam.Encode(), nil)
+	if err != nil {
+		log.Error("Failed to create http request", "err", err)
+		return ImageSearchResult{err: &err, images: []ImageData{}}
+	}
+	req, err := api.cache.CachedFetch(getReq, api.Http, api.TTL())
+	if err != nil {
+		log.Error("Failed to fetch", "err", err)
+		return ImageSearchResult{err: &err, images: []ImageData{}}
+	}
+	defer req.Body.Close()
+
+	data := FlickrSearchResult{}
+	err = json.NewDecoder(req.Body).Decode(&data)
+	if err != nil {
+		log.Error("Failed to decode response", "err", err)
+		return ImageSearchResult{err: &err, images: []ImageData{}}
+	}
+	// Flickr reports errors with a 200 status
+	if data.Stat != "ok" {
+		err = errors.New("flickr: " + data.Message)
+		log.Error("Search failed", "err", err)
+		return ImageSearchResult{err: &err, images: []ImageData{}}
+	}
+	// asking past the last page returns the last page again
+	if data.Photos.Page < page {
+		return ImageSearchResult{err: nil, images: []ImageData{}}
+	}
+	output := make([]ImageData, len(data.Photos.Photo))
+	for i, el := range data.Photos.Photo {
+		licence := flickrLicences[el.License]
+		output[i].Id = "flickr/" + el.Id
+		output[i].Name = strings.Join(strings.Fields(el.Tags), ", ")
+		if output[i].Name == "" {
+			output[i].Name = el.Title
+		}
+		output[i].Source = "Flickr"
+		output[i].SourceUrl = "https://www.flickr.com/photos/" + el.Owner + "/" + el.Id
+		output[i].Artist = el.OwnerName
+		output[i].ArtistUrl = "https://www.flickr.com/photos/" + el.Owner + "/"
+		output[i].Licence = licence.Name
+		output[i].LicenceUrl = licence.Url
+		output[i].setSize(flickrSize(el))
+		output[i].PreviewUrl = firstNonEmpty(el.UrlZ, el.UrlM, el.UrlC, el.UrlL)
+		output[i].DownloadUrl = firstNonEmpty(el.UrlO, el.UrlL, el.UrlC, el.UrlZ, el.UrlM)
+	}
+	return ImageSearchResult{err: nil, images: output}
+}
+
+// flickrSize is the largest size Flickr returned dimensions for
+func flickrSize(el FlickrPhoto) (float32, float32) {
+	for _, dims := range [][2]flickrInt{{el.WidthO, el.HeightO}, {el.WidthL, el.HeightL}, {el.WidthM, el.HeightM}} {
+		if dims[1] > 0 {
+			return float32(dims[0]), float32(dims[1])
+		}
+	}
+	return 0, 0
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
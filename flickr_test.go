@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlickrSearch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("api_key") != "test-key" {
+			w.Write([]byte(`{"stat":"fail","code":100,"message":"Invalid API Key (Key has invalid format)"}`))
+			return
+		}
+		assert.Equal(t, "flickr.photos.search", q.Get("method"))
+		assert.Equal(t, flickrLicenceIds, q.Get("license"))
+		assert.Equal(t, "500", q.Get("per_page"))
+		http.ServeFile(w, r, "testdata/flickr_search.json")
+	}))
+	defer srv.Close()
+
+	cfg := defaultConfig()
+	cfg.Flickr.Key = KeyList{"test-key"}
+	api := NewFlickrApi(&cfg, newTestCache(t))
+	api.baseUrl = srv.URL
+
+	res := api.Search(context.Background(), 1, "harbour")
+	assert.Nil(t, res.err)
+	assert.Equal(t, 2, len(res.images))
+
+	img := res.images[0]
+	assert.Equal(t, "flickr/53012345678", img.Id)
+	assert.Equal(t, "harbour, night, boats", img.Name)
+	assert.Equal(t, "Jane Example", img.Artist)
+	assert.Equal(t, "https://www.flickr.com/photos/12345678@N00/", img.ArtistUrl)
+	assert.Equal(t, "https://www.flickr.com/photos/12345678@N00/53012345678", img.SourceUrl)
+	assert.Equal(t, "CC BY 2.0", img.Licence)
+	assert.Equal(t, float32(1.5), img.Aspect)
+	assert.Contains(t, img.PreviewUrl, "_z.jpg")
+	assert.Contains(t, img.DownloadUrl, "_o.jpg")
+
+	img = res.images[1]
+	assert.Equal(t, "Old pier", img.Name)
+	assert.Equal(t, "CC0 1.0", img.Licence)
+	assert.Equal(t, float32(0.75), img.Aspect)
+	assert.Equal(t, img.PreviewUrl, img.DownloadUrl, "Only the medium size is available")
+
+	res = api.Search(context.Background(), 4, "harbour")
+	assert.Nil(t, res.err)
+	assert.Equal(t, 0, len(res.images), "Page past the end is empty")
+
+	cfg.Flickr.Key = KeyList{"bad-key"}
+	api = NewFlickrApi(&cfg, newTestCache(t))
+	api.baseUrl = srv.URL
+	res = api.Search(context.Background(), 1, "harbour")
+	assert.NotNil(t, res.err, "stat fail is reported as an error")
+}
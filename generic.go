@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// GenericConfig describes a JSON search API in the config file, so simple
+// providers can be added without any code
+type GenericConfig struct {
+	Name     string            `json:"name"`
+	Source   string            `json:"source"`
+	Url      string            `json:"url"`
+	Query    string            `json:"query"`
+	Page     string            `json:"page"`
+	Offset   string            `json:"offset"`
+	PerPage  string            `json:"perPage"`
+	PageSize int               `json:"pageSize"`
+	Params   map[string]string `json:"params"`
+	Headers  map[string]string `json:"headers"`
+	Key      KeyList           `json:"key"`
+	Auth     struct {
+		Param  string `json:"param"`
+		Header string `json:"header"`
+		Prefix string `json:"prefix"`
+	} `json:"auth"`
+	Results string            `json:"results"`
+	Fields  map[string]string `json:"fields"`
+	TTL     int               `json:"ttl"`
+	Http    HttpConfig        `json:"http"`
+}
+
+// genericFields are the mappings a generic provider understands, the
+// ImageData json names plus width and height to work out the aspect
+var genericFields = map[string]bool{
+	"id": true, "tags": true, "sourceUrl": true, "artist": true, "artistUrl": true,
+	"licence": true, "licenceUrl": true, "attribution": true, "aspect": true,
+	"width": true, "height": true, "color": true, "blurhash": true,
+	"previewUrl": true, "downloadUrl": true,
+}
+
+type GenericApi struct {
+	Http  *Upstream
+	cache *ReqCache
+	cfg   GenericConfig
+}
+
+func NewGenericApi(cfg *Config, provider GenericConfig, cache *ReqCache) (GenericApi, error) {
+	if provider.Name == "" || provider.Url == "" {
+		return GenericApi{}, errors.New("name and url are required")
+	}
+	if _, hasId := provider.Fields["id"]; !hasId {
+		return GenericApi{}, errors.New("fields.id is required")
+	}
+	if _, hasPreview := provider.Fields["previewUrl"]; !hasPreview {
+		return GenericApi{}, errors.New("fields.previewUrl is required")
+	}
+	for field := range provider.Fields {
+		if !genericFields[field] {
+			return GenericApi{}, fmt.Errorf("unknown field %q", field)
+		}
+	}
+	if provider.Query == "" {
+		provider.Query = "q"
+	}
+	if provider.Page == "" && provider.Offset == "" {
+		provider.Page = "page"
+	}
+	if provider.PageSize <= 0 {
+		provider.PageSize = 20
+	}
+	if provider.TTL <= 0 {
+		provider.TTL = 3600
+	}
+	if provider.Source == "" {
+		provider.Source = provider.Name
+	}
+	auth := provider.Auth
+	return GenericApi{
+		Http: NewUpstream(provider.Name, cfg.Http.merge(provider.Http)).WithKeys(provider.Key,
+			func(req *http.Request, key string) {
+				if auth.Header != "" {
+					req.Header.Set(auth.Header, auth.Prefix+key)
+					return
+				}
+				q := req.URL.Query()
+				q.Set(firstNonEmpty(auth.Param, "key"), key)
+				req.URL.RawQuery = q.Encode()
+			}),
+		cache: cache,
+		cfg:   provider,
+	}, nil
+}
+
+func (api *GenericApi) Type() string {
+	return api.cfg.Name
+}
+
+func (api *GenericApi) TTL() int {
+	return api.cfg.TTL
+}
+
+func (api *GenericApi) PageSize() int { return api.cfg.PageSize }
+
+func (api *GenericApi) Search(ctx context.Context, page int, query string) ImageSearchResult {
+	log := logFrom(ctx).With("provider", api.Type())
+	qParam := url.Values{}
+	for name, value := range api.cfg.Params {
+		qParam.Set(name, value)
+	}
+	qParam.Set(api.cfg.Query, query)
+	if api.cfg.Page != "" {
+		qParam.Set(api.cfg.Page, strconv.Itoa(page))
+	}
+	if api.cfg.Offset != "" {
+		qParam.Set(api.cfg.Offset, strconv.Itoa((page-1)*api.PageSize()))
+	}
+	if api.cfg.PerPage != "" {
+		qParam.Set(api.cfg.PerPage, strconv.Itoa(api.PageSize()))
+	}
+	sep := "?"
+	if strings.Contains(api.cfg.Url, "?") {
+		sep = "&"
+	}
+	getReq, err := http.NewRequestWithContext(ctx, http.MethodGet, api.cfg.Url+sep+qParam.Encode(), nil)
+	if err != nil {
+		log.Error("Failed to create http request", "err", err)
+		return ImageSearchResult{err: &err, images: []ImageData{}}
+	}
+	for name, value := range api.cfg.Headers {
+		getReq.Header.Set(name, value)
+	}
+	req, err := api.cache.CachedFetch(getReq, api.Http, api.TTL())
+	if err != nil {
+		log.Error("Failed to fetch", "err", err)
+		return ImageSearchResult{err: &err, images: []ImageData{}}
+	}
+	defer req.Body.Close()
+
+	var data interface{}
+	dec := json.NewDecoder(req.Body)
+	dec.UseNumber()
+	err = dec.Decode(&data)
+	if err != nil {
+		log.Error("Failed to decode response", "err", err)
+		return ImageSearchResult{err: &err, images: []ImageData{}}
+	}
+	found, _ := jsonPath(data, api.cfg.Results)
+	items, ok := found.([]interface{})
+	if !ok {
+		err = fmt.Errorf("%s results %q is not a list", api.Type(), api.cfg.Results)
+		log.Error("Failed to decode response", "err", err)
+		return ImageSearchResult{err: &err, images: []ImageData{}}
+	}
+	output := make([]ImageData, 0, len(items))
+	index := make([]int, 0, len(items))
+	for i, item := range items {
+		field := func(name string) string {
+			return jsonTemplate(item, api.cfg.Fields[name])
+		}
+		img := ImageData{
+			Id:          field("id"),
+			Name:        field("tags"),
+			Source:      api.cfg.Source,
+			SourceUrl:   field("sourceUrl"),
+			Artist:      field("artist"),
+			ArtistUrl:   field("artistUrl"),
+			Licence:     field("licence"),
+			LicenceUrl:  field("licenceUrl"),
+			Attribution: field("attribution"),
+			Color:       field("color"),
+			Blurhash:    field("blurhash"),
+			PreviewUrl:  field("previewUrl"),
+			DownloadUrl: firstNonEmpty(field("downloadUrl"), field("previewUrl")),
+		}
+		if img.Id == "" || img.PreviewUrl == "" {
+			continue
+		}
+		img.Id = api.Type() + "/" + img.Id
+		img.setSize(positiveFloat(field("width")), positiveFloat(field("height")))
+		if aspect := positiveFloat(field("aspect")); aspect > 0 {
+			img.Aspect = aspect
+		}
+		output = append(output, img)
+		index = append(index, i)
+	}
+	return ImageSearchResult{err: nil, images: output, raw: len(items), index: index}
+}
+
+// positiveFloat parses a size mapped from the response, anything that is not
+// a finite positive number (including NaN and Inf) is 0
+func positiveFloat(s string) float32 {
+	f, err := strconv.ParseFloat(s, 32)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) || f <= 0 {
+		return 0
+	}
+	return float32(f)
+}
+
+// jsonPath looks up a simple JSONPath such as `$.hits`, `user.name` or
+// `urls[0].small` in decoded JSON, an empty path is the value itself
+func jsonPath(data interface{}, path string) (interface{}, bool) {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if path == "" {
+		return data, true
+	}
+	path = strings.ReplaceAll(path, "[", ".[")
+	for _, part := range strings.Split(path, ".") {
+		if part == "" {
+			continue
+		}
+		if strings.HasPrefix(part, "[") && strings.HasSuffix(part, "]") {
+			list, ok := data.([]interface{})
+			if !ok {
+				return nil, false
+			}
+			idx, err := strconv.Atoi(part[1 : len(part)-1])
+			if err != nil || idx < 0 || idx >= len(list) {
+				return nil, false
+			}
+			data = list[idx]
+			continue
+		}
+		obj, ok := data.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if data, ok = obj[part]; !ok {
+			return nil, false
+		}
+	}
+	return data, true
+}
+
+// jsonString formats a JSON value found by jsonPath, lists are joined with
+// commas so tag arrays can be mapped directly
+func jsonString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case []interface{}:
+		parts := make([]string, 0, len(v))
+		for _, item := range v {
+			if s := jsonString(item); s != "" {
+				parts = append(parts, s)
+			}
+		}
+		return strings.Join(parts, ", ")
+	}
+	return ""
+}
+
+var jsonTemplateVar = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// jsonTemplate maps a field, either a path or a template such as
+// `https://example.com/photos/{id}` with paths in braces
+func jsonTemplate(data interface{}, mapping string) string {
+	if mapping == "" {
+		return ""
+	}
+	if !strings.Contains(mapping, "{") {
+		value, _ := jsonPath(data, mapping)
+		return jsonString(value)
+	}
+	return jsonTemplateVar.ReplaceAllStringFunc(mapping, func(match string) string {
+		value, _ := jsonPath(data, match[1:len(match)-1])
+		return jsonString(value)
+	})
+}
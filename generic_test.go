@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJsonPath(t *testing.T) {
+	dec := json.NewDecoder(strings.NewReader(`{"a": {"b": [{"c": "x"}, {"c": 2.5}], "n": 12345678901234567890, "t": true, "l": ["p", "q"]}}`))
+	dec.UseNumber()
+	var data interface{}
+	assert.NoError(t, dec.Decode(&data))
+
+	tests := []struct {
+		path  string
+		value string
+		found bool
+	}{
+		{"$.a.b[0].c", "x", true},
+		{"a.b[1].c", "2.5", true},
+		{"$.a.n", "12345678901234567890", true},
+		{"a.t", "true", true},
+		{"a.l", "p, q", true},
+		{"a.l[1]", "q", true},
+		{"a.b[2].c", "", false},
+		{"a.b.c", "", false},
+		{"a.missing", "", false},
+		{"a.l[x]", "", false},
+	}
+	for _, test := range tests {
+		value, found := jsonPath(data, test.path)
+		assert.Equal(t, test.found, found, test.path)
+		assert.Equal(t, test.value, jsonString(value), test.path)
+	}
+	assert.Equal(t, "https://example.com/x/12345678901234567890",
+		jsonTemplate(data, "https://example.com/{a.b[0].c}/{$.a.n}"))
+}
+
+func TestPositiveFloat(t *testing.T) {
+	assert.Equal(t, float32(1.5), positiveFloat("1.5"))
+	for _, s := range []string{"", "0", "-2", "NaN", "Inf", "-Inf", "1e40", "wide"} {
+		assert.Equal(t, float32(0), positiveFloat(s), s)
+	}
+}
+
+func TestGenericSearch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Token test-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		q := r.URL.Query()
+		assert.Equal(t, "fog", q.Get("search"))
+		assert.Equal(t, "50", q.Get("start"))
+		assert.Equal(t, "25", q.Get("limit"))
+		assert.Equal(t, "photo", q.Get("type"))
+		http.ServeFile(w, r, "testdata/generic_search.json")
+	}))
+	defer srv.Close()
+
+	cfg := defaultConfig()
+	provider := GenericConfig{
+		Name:     "dam",
+		Source:   "Our DAM",
+		Url:      srv.URL + "/search",
+		Query:    "search",
+		Offset:   "start",
+		PerPage:  "limit",
+		PageSize: 25,
+		Params:   map[string]string{"type": "photo"},
+		Key:      KeyList{"test-key"},
+		Results:  "$.data.assets",
+		Fields: map[string]string{
+			"id":          "id",
+			"tags":        "keywords",
+			"sourceUrl":   "https://dam.example.com/assets/{id}",
+			"artist":      "owner.name",
+			"artistUrl":   "https://dam.example.com/users/{owner.handle}",
+			"width":       "size.w",
+			"height":      "size.h",
+			"previewUrl":  "renditions[0].url",
+			"downloadUrl": "renditions[1].url",
+		},
+	}
+	provider.Auth.Header = "Authorization"
+	provider.Auth.Prefix = "Token "
+	api, err := NewGenericApi(&cfg, provider, newTestCache(t))
+	assert.NoError(t, err)
+	assert.Equal(t, "dam", api.Type())
+
+	res := api.Search(context.Background(), 3, "fog")
+	assert.Nil(t, res.err)
+	assert.Equal(t, 2, len(res.images), "Results without a preview are skipped")
+
+	img := res.images[0]
+	assert.Equal(t, "dam/90071992547409931", img.Id)
+	assert.Equal(t, "fog, forest", img.Name)
+	assert.Equal(t, "Our DAM", img.Source)
+	assert.Equal(t, "https://dam.example.com/assets/90071992547409931", img.SourceUrl)
+	assert.Equal(t, "Jane Example", img.Artist)
+	assert.Equal(t, "https://dam.example.com/users/jane", img.ArtistUrl)
+	assert.Equal(t, float32(1.5), img.Aspect)
+	assert.Equal(t, "https://cdn.example.com/90071992547409931/full.jpg", img.DownloadUrl)
+
+	img = res.images[1]
+	assert.Equal(t, "dam/b-2", img.Id)
+	assert.Equal(t, float32(0), img.Aspect)
+	assert.Equal(t, img.PreviewUrl, img.DownloadUrl, "Download falls back to the preview")
+
+	_, err = NewGenericApi(&cfg, GenericConfig{Name: "bad", Url: srv.URL, Fields: map[string]string{"id": "id"}}, nil)
+	assert.Error(t, err, "previewUrl mapping is required")
+	provider.Fields["colour"] = "color"
+	_, err = NewGenericApi(&cfg, provider, nil)
+	assert.Error(t, err, "Unknown fields are rejected")
+}
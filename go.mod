@@ -1,6 +1,6 @@
 module main
 
-go 1.18
+go 1.21
 
 require github.com/mattn/go-sqlite3 v1.14.17
 
@@ -8,15 +8,24 @@ require (
 	github.com/alexedwards/argon2id v0.0.0-20231016161201-27bf9713919b
 	github.com/andybalholm/brotli v1.0.6
 	github.com/apibillme/cache v0.0.0-20180927200649-e0b3581c9b4d
+	github.com/prometheus/client_golang v1.18.0
 	github.com/stretchr/testify v1.8.4
+	golang.org/x/image v0.18.0
 )
 
 require (
+	github.com/beorn7/perks v1.0.1 // indirect
+	github.com/cespare/xxhash/v2 v2.2.0 // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/kr/text v0.2.0 // indirect
+	github.com/matttproud/golang_protobuf_extensions/v2 v2.0.0 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	github.com/pwaller/goupx v0.0.0-20160623083017-1d58e01d5ce2 // indirect
+	github.com/prometheus/client_model v0.5.0 // indirect
+	github.com/prometheus/common v0.45.0 // indirect
+	github.com/prometheus/procfs v0.12.0 // indirect
 	github.com/smartystreets/goconvey v1.8.1 // indirect
 	golang.org/x/crypto v0.7.0 // indirect
-	golang.org/x/sys v0.6.0 // indirect
+	golang.org/x/sys v0.15.0 // indirect
+	google.golang.org/protobuf v1.31.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// Pinger is implemented by searchers that can check their upstream service is
+// reachable without spending any search quota
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+type Health struct {
+	cfg      *Config
+	store    *Store
+	apis     []ImageSearcher
+	breakers Breakers
+	stopping context.Context
+}
+
+type HealthStatus struct {
+	Status   string            `json:"status"`
+	Checks   map[string]string `json:"checks,omitempty"`
+	Circuits map[string]string `json:"circuits,omitempty"`
+}
+
+// NewHealth creates the liveness and readiness handlers, readiness fails once
+// stopping is cancelled so no new traffic is routed during shutdown. An open
+// circuit is reported but does not fail readiness, the other providers can
+// still answer
+func NewHealth(stopping context.Context, cfg *Config, store *Store, apis []ImageSearcher, breakers Breakers) *Health {
+	return &Health{
+		cfg:      cfg,
+		store:    store,
+		apis:     apis,
+		breakers: breakers,
+		stopping: stopping,
+	}
+}
+
+func (h *Health) Live(w http.ResponseWriter, r *http.Request) {
+	writeJson(w, h.cfg, http.StatusOK, HealthStatus{Status: "ok"})
+}
+
+func (h *Health) Ready(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), h.cfg.Health.Timeout.Std())
+	defer cancel()
+
+	status := HealthStatus{Status: "ok", Checks: map[string]string{}, Circuits: h.breakers.States()}
+	if h.stopping.Err() != nil {
+		status.Status = "stopping"
+	}
+	if err := h.store.Ping(ctx); err != nil {
+		status.Status = "fail"
+		status.Checks["database"] = err.Error()
+	} else {
+		status.Checks["database"] = "ok"
+	}
+
+	if h.cfg.Health.CheckProviders || r.URL.Query().Get("providers") != "" {
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		for _, api := range h.apis {
+			pinger, ok := api.(Pinger)
+			if !ok {
+				continue
+			}
+			wg.Add(1)
+			go func(name string) {
+				defer wg.Done()
+				res := "ok"
+				if err := pinger.Ping(ctx); err != nil {
+					res = err.Error()
+				}
+				mu.Lock()
+				status.Checks[name] = res
+				if res != "ok" {
+					status.Status = "fail"
+				}
+				mu.Unlock()
+			}(api.Type())
+		}
+		wg.Wait()
+	}
+
+	code := http.StatusOK
+	if status.Status != "ok" {
+		code = http.StatusServiceUnavailable
+	}
+	writeJson(w, h.cfg, code, status)
+}
+
+// pingUrl treats any response other than a server error as reachable, the
+// endpoints are hit without credentials so 401/403 are expected
+func pingUrl(ctx context.Context, client *Upstream, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return err
+	}
+	res, err := client.client.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode >= 500 {
+		return fmt.Errorf("upstream returned %s", res.Status)
+	}
+	return nil
+}
+
+func writeJson(w http.ResponseWriter, cfg *Config, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	if cfg.Debug.PrettyJson {
+		enc.SetIndent("", "  ")
+	}
+	enc.Encode(v)
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"image"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ImageMeta is what is computed locally from an image's preview, for
+// providers that do not return it themselves
+type ImageMeta struct {
+	Width    int
+	Height   int
+	Color    string
+	Blurhash string
+	DHash    string
+}
+
+// maxPreviewBytes limits the size of a preview downloaded to compute metadata
+const maxPreviewBytes int64 = 20 << 20
+
+// metaRetryWait is how long an image whose preview could not be decoded is
+// left before it is tried again
+const metaRetryWait = time.Hour
+
+// PreviewOpener is implemented by searchers whose previews are read directly
+// rather than fetched over http, such as the local library
+type PreviewOpener interface {
+	OpenPreview(img ImageData) (io.ReadCloser, error)
+}
+
+type metaJob struct {
+	img    ImageData
+	opener PreviewOpener
+}
+
+// MetaWorker fills in the size, colour, blurhash and dHash of images. Metadata is
+// computed in the background the first time an image is seen and stored, so
+// it is included from the next search that returns the image
+type MetaWorker struct {
+	store   *Store
+	client  *http.Client
+	timeout time.Duration
+	queue   chan metaJob
+	queued  sync.Map
+	failed  sync.Map // id -> time.Time the preview last failed to decode
+	done    chan struct{}
+}
+
+func NewMetaWorker(cfg *Config, store *Store) *MetaWorker {
+	if cfg.ImageMeta.Disabled {
+		return nil
+	}
+	mw := &MetaWorker{
+		store:   store,
+		client:  &http.Client{Transport: sharedTransport},
+		timeout: cfg.Http.Timeout.Std(),
+		queue:   make(chan metaJob, max(1, cfg.ImageMeta.Queue)),
+		done:    make(chan struct{}),
+	}
+	for i := 0; i < max(1, cfg.ImageMeta.Workers); i++ {
+		go mw.run()
+	}
+	return mw
+}
+
+// Close stops the workers, queued images are dropped
+func (mw *MetaWorker) Close() {
+	if mw != nil {
+		close(mw.done)
+	}
+}
+
+func needsMeta(img *ImageData) bool {
+	return img.Width == 0 || img.Color == "" || img.Blurhash == "" || img.DHash == ""
+}
+
+// Fill completes images with any stored metadata, images not seen before are
+// queued to have it computed
+func (mw *MetaWorker) Fill(api ImageSearcher, images []ImageData) {
+	if mw == nil {
+		return
+	}
+	var ids []string
+	for i := range images {
+		if needsMeta(&images[i]) {
+			ids = append(ids, images[i].Id)
+		}
+	}
+	stored := mw.store.GetImageMeta(ids)
+	opener, _ := api.(PreviewOpener)
+	for i := range images {
+		img := &images[i]
+		if !needsMeta(img) {
+			continue
+		}
+		meta, ok := stored[img.Id]
+		// images stored before the dHash was computed are queued again
+		if !ok || meta.DHash == "" {
+			if mw.retryDue(img.Id) {
+				mw.enqueue(metaJob{img: *img, opener: opener})
+			}
+			continue
+		}
+		if img.Width == 0 && meta.Width > 0 {
+			img.setSize(float32(meta.Width), float32(meta.Height))
+		}
+		img.Color = firstNonEmpty(img.Color, meta.Color)
+		img.Blurhash = firstNonEmpty(img.Blurhash, meta.Blurhash)
+		img.DHash = meta.DHash
+	}
+}
+
+// retryDue reports whether id has not failed to decode recently
+func (mw *MetaWorker) retryDue(id string) bool {
+	failedAt, ok := mw.failed.Load(id)
+	if !ok {
+		return true
+	}
+	if time.Since(failedAt.(time.Time)) < metaRetryWait {
+		return false
+	}
+	mw.failed.Delete(id)
+	return true
+}
+
+// enqueue adds job unless the image is already queued, or drops it when the
+// queue is full. It will be queued again the next time it is searched
+func (mw *MetaWorker) enqueue(job metaJob) {
+	if _, loaded := mw.queued.LoadOrStore(job.img.Id, true); loaded {
+		return
+	}
+	select {
+	case mw.queue <- job:
+	default:
+		mw.queued.Delete(job.img.Id)
+	}
+}
+
+func (mw *MetaWorker) run() {
+	for {
+		select {
+		case <-mw.done:
+			return
+		case job := <-mw.queue:
+			mw.compute(job)
+			mw.queued.Delete(job.img.Id)
+		}
+	}
+}
+
+func (mw *MetaWorker) compute(job metaJob) {
+	log := slog.Default().With("component", "imagemeta", "id", job.img.Id)
+	ctx, cancel := context.WithTimeout(context.Background(), mw.timeout)
+	defer cancel()
+	body, err := mw.open(ctx, job)
+	if err != nil {
+		log.Warn("Failed to fetch preview", "err", err)
+		return
+	}
+	defer body.Close()
+	// images that cannot be decoded are not stored, they are tried again
+	// after metaRetryWait
+	img, _, err := image.Decode(io.LimitReader(body, maxPreviewBytes))
+	if err != nil {
+		log.Warn("Failed to decode preview", "err", err)
+		mw.failed.Store(job.img.Id, time.Now())
+		return
+	}
+	mw.store.StoreImageMeta(job.img.Id, ImageMeta{
+		Width:    img.Bounds().Dx(),
+		Height:   img.Bounds().Dy(),
+		Color:    averageColor(img),
+		Blurhash: encodeBlurhash(img),
+		DHash:    dHash(img),
+	})
+}
+
+func (mw *MetaWorker) open(ctx context.Context, job metaJob) (io.ReadCloser, error) {
+	if job.opener != nil {
+		return job.opener.OpenPreview(job.img)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, job.img.PreviewUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := mw.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, &StatusError{Provider: "preview", Code: resp.StatusCode, Status: resp.Status}
+	}
+	return resp.Body, nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetaWorker(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if r.URL.Path == "/broken.jpg" {
+			w.Write([]byte("not an image"))
+			return
+		}
+		png.Encode(w, image.NewGray(image.Rect(0, 0, 40, 20)))
+	}))
+	defer srv.Close()
+
+	cfg := defaultConfig()
+	mw := NewMetaWorker(&cfg, newTestCache(t).store)
+	defer mw.Close()
+	api := &PexelsApi{}
+
+	search := func() []ImageData {
+		images := []ImageData{
+			{Id: "test/1", PreviewUrl: srv.URL + "/1.png"},
+			{Id: "test/2", PreviewUrl: srv.URL + "/broken.jpg"},
+			{Id: "test/3", PreviewUrl: srv.URL + "/3.png", Width: 4000, Height: 3000, Aspect: 4.0 / 3,
+				Color: "#aabbcc", Blurhash: "LEHV6nWB2yk8pyo0adR*.7kCMdnj"},
+		}
+		mw.Fill(api, images)
+		return images
+	}
+	images := search()
+	assert.Equal(t, "", images[0].Blurhash, "Computed in the background")
+	assert.Eventually(t, func() bool {
+		return len(mw.store.GetImageMeta([]string{"test/1", "test/2", "test/3"})) == 2 && calls.Load() == 3
+	}, 5*time.Second, 10*time.Millisecond, "Images with upstream metadata are fetched for the dHash")
+
+	images = search()
+	assert.Equal(t, 40, images[0].Width)
+	assert.Equal(t, float32(2), images[0].Aspect)
+	assert.Equal(t, "#000000", images[0].Color)
+	assert.Equal(t, 28, len(images[0].Blurhash))
+	assert.Equal(t, "", images[1].Blurhash)
+	assert.Equal(t, 16, len(images[0].DHash))
+	assert.Equal(t, 4000, images[2].Width, "Upstream metadata is kept")
+	assert.Equal(t, "#aabbcc", images[2].Color)
+	assert.Equal(t, 16, len(images[2].DHash))
+
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int32(3), calls.Load(), "Broken previews are not fetched again right away")
+
+	mw.failed.Store("test/2", time.Now().Add(-metaRetryWait))
+	search()
+	assert.Eventually(t, func() bool {
+		return calls.Load() == 4
+	}, 5*time.Second, 10*time.Millisecond, "Broken previews are tried again later")
+
+	mw.store.StoreImageMeta("test/1", ImageMeta{Width: 40, Height: 20, Color: "#000000", Blurhash: "L00000fQfQfQfQfQfQfQfQfQfQfQ"})
+	search()
+	assert.Eventually(t, func() bool {
+		return mw.store.GetImageMeta([]string{"test/1"})["test/1"].DHash != ""
+	}, 5*time.Second, 10*time.Millisecond, "Stored metadata without a dHash is computed again")
+
+	var disabled *MetaWorker
+	disabled.Fill(api, images)
+	disabled.Close()
+}
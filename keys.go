@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// KeyList holds the API keys for a provider, the configuration accepts a
+// single key or a list of them
+type KeyList []string
+
+func (k *KeyList) UnmarshalJSON(b []byte) error {
+	var list []string
+	if err := json.Unmarshal(b, &list); err != nil {
+		var key string
+		if err := json.Unmarshal(b, &key); err != nil {
+			return err
+		}
+		list = []string{key}
+	}
+	*k = (*k)[:0]
+	for _, key := range list {
+		if key != "" {
+			*k = append(*k, key)
+		}
+	}
+	return nil
+}
+
+// WithKeys sets the keys the upstream rotates through, authorize adds a key
+// to a request. Requests are built and cached without credentials so every
+// key shares the same cache entries
+func (u *Upstream) WithKeys(keys KeyList, authorize func(req *http.Request, key string)) *Upstream {
+	u.keys = keys
+	u.authorize = authorize
+	return u
+}
+
+// WithQuotas tracks the upstream's key quotas in qt instead of the shared
+// tracker the admin endpoint lists
+func (u *Upstream) WithQuotas(qt *QuotaTracker) *Upstream {
+	qt.SetReserve(u.name, u.cfg.QuotaReserve)
+	u.quotas = qt
+	return u
+}
+
+// keyOrder lists the keys to try, most remaining quota first. Keys with the
+// same (or unknown) quota take turns
+func (u *Upstream) keyOrder() []string {
+	start := int(u.next.Add(1)-1) % len(u.keys)
+	keys := make([]string, 0, len(u.keys))
+	keys = append(keys, u.keys[start:]...)
+	keys = append(keys, u.keys[:start]...)
+	remaining := func(key string) int {
+		if q, ok := u.quotas.Get(u.name, key); ok && time.Now().Before(q.Reset) {
+			return q.Remaining
+		}
+		return math.MaxInt
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		return remaining(keys[i]) > remaining(keys[j])
+	})
+	return keys
+}
+
+// Do sends req with the best available key, failing over to the next key when
+// one is rejected (401) or rate limited (429). Keys close to their rate limit
+// are skipped, and a QuotaError returned when none are left
+func (u *Upstream) Do(req *http.Request) (*http.Response, error) {
+	if len(u.keys) == 0 {
+		return u.send(req, "")
+	}
+	log := logFrom(req.Context())
+	var resp *http.Response
+	var reset time.Time
+	for _, key := range u.keyOrder() {
+		if until, low := u.quotas.Exhausted(u.name, key); low {
+			if reset.IsZero() || until.Before(reset) {
+				reset = until
+			}
+			continue
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+		keyReq := req.Clone(req.Context())
+		u.authorize(keyReq, key)
+		var err error
+		resp, err = u.send(keyReq, key)
+		if err != nil {
+			return nil, err
+		}
+		switch resp.StatusCode {
+		case http.StatusUnauthorized:
+			u.quotas.Revoke(u.name, key)
+		case http.StatusTooManyRequests:
+		default:
+			return resp, nil
+		}
+		log.Warn("API key refused, trying next key", "provider", u.name, "key", keyId(key), "status", resp.StatusCode)
+	}
+	if resp == nil {
+		return nil, &QuotaError{Provider: u.name, Reset: reset}
+	}
+	return resp, nil
+}
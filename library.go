@@ -0,0 +1,476 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// libraryExts are the image types picked up by the library index
+var libraryExts = map[string]bool{
+	".jpg":  true,
+	".jpeg": true,
+	".png":  true,
+	".gif":  true,
+	".webp": true,
+}
+
+// libraryPreviewSize is the longest side of the previews made of library
+// images, smaller images are served as they are
+const libraryPreviewSize int = 800
+
+// LibrarySidecar is the metadata read from a `photo.json` or `photo.jpg.json`
+// file next to the image, any field left empty falls back to the XMP sidecar
+// and then the library defaults
+type LibrarySidecar struct {
+	Title      string   `json:"title"`
+	Tags       []string `json:"tags"`
+	Artist     string   `json:"artist"`
+	ArtistUrl  string   `json:"artistUrl"`
+	Licence    string   `json:"licence"`
+	LicenceUrl string   `json:"licenceUrl"`
+	SourceUrl  string   `json:"sourceUrl"`
+}
+
+type libraryImage struct {
+	ImageData
+	file  string
+	words map[string]int
+}
+
+type libraryIndex struct {
+	mu     sync.RWMutex
+	images []libraryImage
+	files  map[string]string
+}
+
+// LocalLibrary searches a directory of our own images. The directory is
+// indexed on start and every `rescan`, the images are served by the proxy
+// under /library/ and downscaled previews of them under /library-previews/
+type LocalLibrary struct {
+	cfg        *Config
+	dir        string
+	url        string
+	previewUrl string
+	previewDir string
+	index      *libraryIndex
+}
+
+func NewLocalLibrary(cfg *Config) LocalLibrary {
+	lib := LocalLibrary{
+		cfg:        cfg,
+		dir:        cfg.Library.Dir,
+		url:        cfg.Library.Url,
+		previewUrl: cfg.Library.PreviewUrl,
+		previewDir: cfg.Library.PreviewDir,
+		index:      &libraryIndex{files: map[string]string{}},
+	}
+	if lib.previewDir == "" {
+		lib.previewDir = filepath.Join(os.TempDir(), "stockimgproxy-previews")
+	}
+	if err := lib.Scan(); err != nil {
+		slog.Error("Failed to index library", "dir", lib.dir, "err", err)
+	}
+	return lib
+}
+
+func (lib *LocalLibrary) Type() string {
+	return "library"
+}
+
+func (lib *LocalLibrary) TTL() int {
+	return 0
+}
+
+func (lib *LocalLibrary) PageSize() int { return 100 }
+
+// Preferred puts the library results ahead of the other providers
+func (lib *LocalLibrary) Preferred() bool { return true }
+
+func (lib *LocalLibrary) Ping(ctx context.Context) error {
+	_, err := os.Stat(lib.dir)
+	return err
+}
+
+func (lib *LocalLibrary) Search(ctx context.Context, page int, query string) ImageSearchResult {
+	terms := matchWords(query)
+	type match struct {
+		score int
+		img   *libraryImage
+	}
+	lib.index.mu.RLock()
+	defer lib.index.mu.RUnlock()
+	var matches []match
+	for i := range lib.index.images {
+		img := &lib.index.images[i]
+		score := 0
+		for _, term := range terms {
+			score += img.score(term)
+		}
+		if score > 0 {
+			matches = append(matches, match{score, img})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].score > matches[j].score
+	})
+	first := min(len(matches), (page-1)*lib.PageSize())
+	last := min(len(matches), page*lib.PageSize())
+	output := make([]ImageData, 0, last-first)
+	for _, m := range matches[first:last] {
+		output = append(output, m.img.ImageData)
+	}
+	return ImageSearchResult{err: nil, images: output}
+}
+
+// score is the best weight of any of the image's words matching term, either
+// exactly or as a prefix
+func (img *libraryImage) score(term string) int {
+	if weight, ok := img.words[term]; ok {
+		return weight
+	}
+	if len(term) < 3 {
+		return 0
+	}
+	for word := range img.words {
+		if strings.HasPrefix(word, term) {
+			return matchPrefixWeight
+		}
+	}
+	return 0
+}
+
+// Watch rescans the library directory every interval until ctx is done
+func (lib *LocalLibrary) Watch(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+			if err := lib.Scan(); err != nil {
+				slog.Error("Failed to index library", "dir", lib.dir, "err", err)
+			}
+		}
+	}
+}
+
+// Scan rebuilds the index from the library directory, the previous index is
+// kept if the directory cannot be read
+func (lib *LocalLibrary) Scan() error {
+	var images []libraryImage
+	files := map[string]string{}
+	err := filepath.WalkDir(lib.dir, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(d.Name(), ".") && file != lib.dir {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !libraryExts[strings.ToLower(filepath.Ext(file))] {
+			return nil
+		}
+		rel, err := filepath.Rel(lib.dir, file)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		images = append(images, lib.readImage(file, rel))
+		files[rel] = file
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	lib.index.mu.Lock()
+	lib.index.images = images
+	lib.index.files = files
+	lib.index.mu.Unlock()
+	slog.Info("Indexed library", "dir", lib.dir, "images", len(images))
+	return nil
+}
+
+func (lib *LocalLibrary) readImage(file string, rel string) libraryImage {
+	base := strings.TrimSuffix(file, filepath.Ext(file))
+	meta := LibrarySidecar{}
+	for _, sidecar := range []string{file + ".json", base + ".json"} {
+		if readJsonSidecar(sidecar, &meta) {
+			break
+		}
+	}
+	for _, sidecar := range []string{file + ".xmp", base + ".xmp"} {
+		if readXmpSidecar(sidecar, &meta) {
+			break
+		}
+	}
+	escaped := (&url.URL{Path: rel}).EscapedPath()
+	link := lib.url + escaped
+	img := libraryImage{
+		ImageData: ImageData{
+			Id:          "library/" + rel,
+			Name:        strings.Join(meta.Tags, ", "),
+			Source:      lib.cfg.Library.Name,
+			SourceUrl:   firstNonEmpty(meta.SourceUrl, link),
+			Artist:      firstNonEmpty(meta.Artist, lib.cfg.Library.Artist),
+			ArtistUrl:   meta.ArtistUrl,
+			Licence:     firstNonEmpty(meta.Licence, lib.cfg.Library.Licence),
+			LicenceUrl:  firstNonEmpty(meta.LicenceUrl, lib.cfg.Library.LicenceUrl),
+			PreviewUrl:  lib.previewUrl + escaped,
+			DownloadUrl: link,
+		},
+		file:  rel,
+		words: map[string]int{},
+	}
+	if img.Name == "" {
+		img.Name = meta.Title
+	}
+	if f, err := os.Open(file); err == nil {
+		if conf, _, err := image.DecodeConfig(f); err == nil {
+			img.setSize(float32(conf.Width), float32(conf.Height))
+		}
+		f.Close()
+	}
+	name := strings.TrimSuffix(path.Base(rel), path.Ext(rel))
+	for _, word := range matchWords(meta.Title + " " + name) {
+		img.words[word] = matchWordWeight
+	}
+	for _, tag := range meta.Tags {
+		for _, word := range matchWords(tag) {
+			img.words[word] = matchTagWeight
+		}
+	}
+	return img
+}
+
+func readJsonSidecar(file string, meta *LibrarySidecar) bool {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return false
+	}
+	if err := json.Unmarshal(data, meta); err != nil {
+		slog.Warn("Invalid library sidecar", "file", file, "err", err)
+		return false
+	}
+	return true
+}
+
+// readXmpSidecar fills any fields not already set from the Dublin Core and
+// XMP rights properties of an XMP sidecar
+func readXmpSidecar(file string, meta *LibrarySidecar) bool {
+	f, err := os.Open(file)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	xmp := LibrarySidecar{}
+	dec := xml.NewDecoder(f)
+	var stack []string
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			slog.Warn("Invalid library sidecar", "file", file, "err", err)
+			return false
+		}
+		switch el := tok.(type) {
+		case xml.StartElement:
+			stack = append(stack, el.Name.Local)
+			for _, attr := range el.Attr {
+				if attr.Name.Local == "WebStatement" {
+					xmp.LicenceUrl = attr.Value
+				}
+			}
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			text := strings.TrimSpace(string(el))
+			if text == "" || len(stack) == 0 {
+				continue
+			}
+			switch xmpProperty(stack) {
+			case "subject":
+				xmp.Tags = append(xmp.Tags, text)
+			case "title":
+				xmp.Title = firstNonEmpty(xmp.Title, text)
+			case "creator":
+				xmp.Artist = firstNonEmpty(xmp.Artist, text)
+			case "rights":
+				xmp.Licence = firstNonEmpty(xmp.Licence, text)
+			case "WebStatement":
+				xmp.LicenceUrl = text
+			}
+		}
+	}
+	meta.Title = firstNonEmpty(meta.Title, xmp.Title)
+	meta.Artist = firstNonEmpty(meta.Artist, xmp.Artist)
+	meta.Licence = firstNonEmpty(meta.Licence, xmp.Licence)
+	meta.LicenceUrl = firstNonEmpty(meta.LicenceUrl, xmp.LicenceUrl)
+	if len(meta.Tags) == 0 {
+		meta.Tags = xmp.Tags
+	}
+	return true
+}
+
+// xmpProperty finds the innermost property of interest that text appears in,
+// values are usually nested in rdf:Bag/rdf:Alt lists
+func xmpProperty(stack []string) string {
+	for i := len(stack) - 1; i >= 0; i-- {
+		switch stack[i] {
+		case "subject", "title", "creator", "rights", "WebStatement":
+			return stack[i]
+		}
+	}
+	return ""
+}
+
+// OpenPreview reads the downscaled preview of an indexed image, so its
+// metadata can be computed without going through http or decoding a large
+// original
+func (lib *LocalLibrary) OpenPreview(img ImageData) (io.ReadCloser, error) {
+	file, ok := lib.indexedFile(strings.TrimPrefix(img.Id, "library/"))
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	preview, err := lib.preview(file)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(preview)
+}
+
+// ServeHTTP serves the indexed images, other files in the library directory
+// such as sidecars are not reachable
+func (lib *LocalLibrary) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	file, ok := lib.indexedFile(strings.TrimPrefix(r.URL.Path, "/library/"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	lib.setCacheControl(w)
+	http.ServeFile(w, r, file)
+}
+
+// ServePreview serves a downscaled copy of an indexed image, previews are
+// made on the first request and kept in the preview directory
+func (lib *LocalLibrary) ServePreview(w http.ResponseWriter, r *http.Request) {
+	file, ok := lib.indexedFile(strings.TrimPrefix(r.URL.Path, "/library-previews/"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	preview, err := lib.preview(file)
+	if err != nil {
+		logFrom(r.Context()).Error("Failed to make library preview", "file", file, "err", err)
+		http.Error(w, "Failed to make preview", http.StatusInternalServerError)
+		return
+	}
+	lib.setCacheControl(w)
+	http.ServeFile(w, r, preview)
+}
+
+func (lib *LocalLibrary) indexedFile(rel string) (string, bool) {
+	lib.index.mu.RLock()
+	defer lib.index.mu.RUnlock()
+	file, ok := lib.index.files[rel]
+	return file, ok
+}
+
+func (lib *LocalLibrary) setCacheControl(w http.ResponseWriter) {
+	// images behind authentication must not be kept by shared caches
+	if lib.cfg.Library.Auth {
+		w.Header().Set("Cache-Control", "private, max-age=86400")
+	} else {
+		w.Header().Set("Cache-Control", "public, max-age=86400")
+	}
+}
+
+// preview returns the file of the preview of file, making it when needed.
+// Previews are named after the file, its size and modification time, so a
+// changed image gets a new preview
+func (lib *LocalLibrary) preview(file string) (string, error) {
+	info, err := os.Stat(file)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256([]byte(file + "\x00" + strconv.FormatInt(info.Size(), 10) + "\x00" + info.ModTime().String()))
+	out := filepath.Join(lib.previewDir, hex.EncodeToString(hash[:16])+".jpg")
+	if _, err := os.Stat(out); err == nil {
+		return out, nil
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	conf, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return "", err
+	}
+	if conf.Width <= libraryPreviewSize && conf.Height <= libraryPreviewSize {
+		return file, nil
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	src, _, err := image.Decode(f)
+	if err != nil {
+		return "", err
+	}
+	w, h := libraryPreviewSize, max(1, conf.Height*libraryPreviewSize/conf.Width)
+	if conf.Height > conf.Width {
+		w, h = max(1, conf.Width*libraryPreviewSize/conf.Height), libraryPreviewSize
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, src.Bounds(), draw.Src, nil)
+
+	// written to a temporary file first so a preview is never served half made
+	if err := os.MkdirAll(lib.previewDir, 0755); err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(lib.previewDir, "preview-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	err = jpeg.Encode(tmp, dst, &jpeg.Options{Quality: 80})
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+	return out, os.Rename(tmp.Name(), out)
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeTestPng(t *testing.T, file string, width int, height int) {
+	assert.NoError(t, os.MkdirAll(filepath.Dir(file), 0755))
+	f, err := os.Create(file)
+	assert.NoError(t, err)
+	defer f.Close()
+	assert.NoError(t, png.Encode(f, image.NewGray(image.Rect(0, 0, width, height))))
+}
+
+func TestLocalLibrary(t *testing.T) {
+	dir := t.TempDir()
+	writeTestPng(t, filepath.Join(dir, "shoot-2023", "red-car.png"), 30, 20)
+	os.WriteFile(filepath.Join(dir, "shoot-2023", "red-car.json"),
+		[]byte(`{"tags": ["car", "street"], "artist": "Studio Team", "licence": "Internal use"}`), 0644)
+	writeTestPng(t, filepath.Join(dir, "harbour.png"), 20, 20)
+	os.WriteFile(filepath.Join(dir, "harbour.xmp"), []byte(`<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description xmlns:dc="http://purl.org/dc/elements/1.1/"
+    xmlns:xmpRights="http://ns.adobe.com/xap/1.0/rights/"
+    xmpRights:WebStatement="https://example.com/licence">
+   <dc:subject><rdf:Bag><rdf:li>boats</rdf:li><rdf:li>red sails</rdf:li></rdf:Bag></dc:subject>
+   <dc:creator><rdf:Seq><rdf:li>Jane Example</rdf:li></rdf:Seq></dc:creator>
+  </rdf:Description>
+ </rdf:RDF>
+</x:xmpmeta>`), 0644)
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not an image"), 0644)
+
+	cfg := defaultConfig()
+	cfg.Library.Dir = dir
+	cfg.Library.Licence = "All rights reserved"
+	lib := NewLocalLibrary(&cfg)
+
+	res := lib.Search(context.Background(), 1, "red")
+	assert.Nil(t, res.err)
+	assert.Equal(t, 2, len(res.images))
+	assert.Equal(t, "library/harbour.png", res.images[0].Id, "Tag matches rank above file names")
+	assert.Equal(t, "Jane Example", res.images[0].Artist)
+	assert.Equal(t, "All rights reserved", res.images[0].Licence)
+	assert.Equal(t, "https://example.com/licence", res.images[0].LicenceUrl)
+	assert.Equal(t, "boats, red sails", res.images[0].Name)
+	assert.Equal(t, float32(1), res.images[0].Aspect)
+
+	img := res.images[1]
+	assert.Equal(t, "library/shoot-2023/red-car.png", img.Id)
+	assert.Equal(t, "Studio Team", img.Artist)
+	assert.Equal(t, "Internal use", img.Licence)
+	assert.Equal(t, "/library-previews/shoot-2023/red-car.png", img.PreviewUrl)
+	assert.Equal(t, "/library/shoot-2023/red-car.png", img.DownloadUrl)
+	assert.Equal(t, float32(1.5), img.Aspect)
+
+	res = lib.Search(context.Background(), 1, "red car")
+	assert.Equal(t, "library/shoot-2023/red-car.png", res.images[0].Id, "More words matched ranks first")
+
+	res = lib.Search(context.Background(), 1, "stree")
+	assert.Equal(t, 1, len(res.images), "Prefix match")
+
+	res = lib.Search(context.Background(), 2, "red")
+	assert.Equal(t, 0, len(res.images), "Page past the end is empty")
+
+	rec := httptest.NewRecorder()
+	lib.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, img.DownloadUrl, nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "image/png", rec.Header().Get("Content-Type"))
+	assert.Equal(t, "public, max-age=86400", rec.Header().Get("Cache-Control"))
+
+	cfg.Library.Auth = true
+	rec = httptest.NewRecorder()
+	lib.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, img.DownloadUrl, nil))
+	assert.Equal(t, "private, max-age=86400", rec.Header().Get("Cache-Control"), "Not kept by shared caches behind auth")
+	cfg.Library.Auth = false
+
+	for _, path := range []string{"/library/shoot-2023/red-car.json", "/library/notes.txt", "/library/../harbour.png"} {
+		rec = httptest.NewRecorder()
+		lib.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, http.StatusNotFound, rec.Code, path)
+	}
+
+	rec = httptest.NewRecorder()
+	lib.ServePreview(rec, httptest.NewRequest(http.MethodGet, img.PreviewUrl, nil))
+	assert.Equal(t, "image/png", rec.Header().Get("Content-Type"), "Small images are their own preview")
+	rec = httptest.NewRecorder()
+	lib.ServePreview(rec, httptest.NewRequest(http.MethodGet, "/library-previews/notes.txt", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	writeTestPng(t, filepath.Join(dir, "red-door.png"), 10, 10)
+	assert.NoError(t, lib.Scan())
+	res = lib.Search(context.Background(), 1, "red")
+	assert.Equal(t, 3, len(res.images), "Rescan picks up new images")
+}
+
+func TestLocalLibraryWebp(t *testing.T) {
+	dir := t.TempDir()
+	data, err := os.ReadFile("testdata/pixel.webp")
+	assert.NoError(t, err)
+	os.WriteFile(filepath.Join(dir, "pixel.webp"), data, 0644)
+
+	cfg := defaultConfig()
+	cfg.Library.Dir = dir
+	lib := NewLocalLibrary(&cfg)
+	res := lib.Search(context.Background(), 1, "pixel")
+	assert.Equal(t, 1, len(res.images))
+	assert.Equal(t, 1, res.images[0].Width, "Size read from webp")
+	assert.Equal(t, float32(1), res.images[0].Aspect)
+
+	f, err := lib.OpenPreview(res.images[0])
+	assert.NoError(t, err)
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	assert.NoError(t, err, "webp previews can be decoded for the placeholders")
+	assert.NotEmpty(t, encodeBlurhash(img))
+}
+
+func TestLocalLibraryPreview(t *testing.T) {
+	dir := t.TempDir()
+	writeTestPng(t, filepath.Join(dir, "shoot", "stage.png"), 2000, 1000)
+
+	cfg := defaultConfig()
+	cfg.Library.Dir = dir
+	cfg.Library.PreviewDir = t.TempDir()
+	lib := NewLocalLibrary(&cfg)
+	res := lib.Search(context.Background(), 1, "stage")
+	assert.Equal(t, 1, len(res.images))
+
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		lib.ServePreview(rec, httptest.NewRequest(http.MethodGet, res.images[0].PreviewUrl, nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "image/jpeg", rec.Header().Get("Content-Type"))
+		conf, _, err := image.DecodeConfig(rec.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, libraryPreviewSize, conf.Width, "Downscaled to the preview size")
+		assert.Equal(t, libraryPreviewSize/2, conf.Height)
+	}
+	f, err := lib.OpenPreview(res.images[0])
+	assert.NoError(t, err)
+	conf, _, err := image.DecodeConfig(f)
+	f.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, libraryPreviewSize, conf.Width, "Metadata is computed from the preview")
+	previews, _ := os.ReadDir(cfg.Library.PreviewDir)
+	assert.Equal(t, 1, len(previews), "Preview is made once")
+}
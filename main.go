@@ -1,115 +1,130 @@
 package main
 
 import (
-	"bufio"
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/andybalholm/brotli"
-	"io"
-	"log"
-	"net"
+	"log/slog"
 	"net/http"
-	"net/http/fcgi"
 	_ "net/http/pprof"
 	"net/url"
 	"os"
+	"os/signal"
+	"slices"
 	"strconv"
 	"strings"
+	"syscall"
+	"time"
 )
 
-type Config struct {
-	Pexels struct {
-		Key string `json:"key"`
-	} `json:"pexels.com"`
-	Unsplash struct {
-		AccessKey string `json:"access"`
-		SecretKey string `json:"secret"`
-	} `json:"unsplash.com"`
-	Pixabay struct {
-		Key string `json:"key"`
-	} `json:"pixabay.com"`
-	Debug struct {
-		PrettyJson bool `json:"prettyJson"`
-	}
-	Database string `json:"database"`
-}
-
-func processError(err error) {
-	fmt.Println(err.Error())
-	os.Exit(2)
-}
-
-func loadConfig(cfg *Config) {
+func initApi(cfg *Config, reqCache *ReqCache) []ImageSearcher {
+	var apis []ImageSearcher
 
-	f, err := os.Open("conf/config.json")
-	if err != nil {
-		processError(err)
+	if cfg.Library.Dir != "" {
+		library := NewLocalLibrary(cfg)
+		apis = append(apis, &library)
+		slog.Info("Configured library", "dir", cfg.Library.Dir)
 	}
-	defer f.Close()
-
-	decoder := json.NewDecoder(f)
-	switch err := decoder.Decode(&cfg).(type) {
-	case *json.SyntaxError:
-		f.Seek(0, io.SeekStart)
-		pos := findPos(bufio.NewReader(f), int(err.Offset))
-		log.Panicf("Unable to decode configuration file (Line: %d, Pos: %d); - %v\n", pos.line, pos.pos, err.Error())
+	if len(cfg.Pixabay.Key) > 0 {
+		apiPixabay := NewPixabayApi(cfg, reqCache)
+		apis = append(apis, &apiPixabay)
+		slog.Info("Configured pixabay.com API Key", "keys", len(cfg.Pixabay.Key))
 	}
-}
-
-type FilePos struct {
-	line int
-	pos  int
-}
-
-func findPos(file *bufio.Reader, offset int) FilePos {
-	p := FilePos{line: 1, pos: offset}
-	var lineLen int
-	for line, err := file.ReadBytes('\n'); len(line) > 0 && err == nil; line, err = file.ReadBytes('\n') {
-		if p.pos < len(line) {
-			return p
+	if len(cfg.Pexels.Key) > 0 {
+		apiPexels := NewPexelsApi(cfg, reqCache)
+		apis = append(apis, &apiPexels)
+		slog.Info("Configured pexels.com API Key", "keys", len(cfg.Pexels.Key))
+	}
+	if len(cfg.Unsplash.AccessKey) > 0 {
+		apiUnsplash := NewUnsplashApi(cfg, reqCache)
+		apis = append(apis, &apiUnsplash)
+		slog.Info("Configured unsplash.com API Key", "keys", len(cfg.Unsplash.AccessKey))
+	}
+	if cfg.Openverse.Enabled {
+		apiOpenverse := NewOpenverseApi(cfg, reqCache)
+		apis = append(apis, &apiOpenverse)
+		slog.Info("Configured openverse.org")
+	}
+	if len(cfg.Flickr.Key) > 0 {
+		apiFlickr := NewFlickrApi(cfg, reqCache)
+		apis = append(apis, &apiFlickr)
+		slog.Info("Configured flickr.com API Key", "keys", len(cfg.Flickr.Key))
+	}
+	if cfg.Met.Enabled {
+		apiMet := NewMetApi(cfg, reqCache)
+		apis = append(apis, &apiMet)
+		slog.Info("Configured metmuseum.org")
+	}
+	if cfg.Artic.Enabled {
+		apiArtic := NewArticApi(cfg, reqCache)
+		apis = append(apis, &apiArtic)
+		slog.Info("Configured artic.edu")
+	}
+	if len(cfg.Rijksmuseum.Key) > 0 {
+		apiRijks := NewRijksApi(cfg, reqCache)
+		apis = append(apis, &apiRijks)
+		slog.Info("Configured rijksmuseum.nl API Key", "keys", len(cfg.Rijksmuseum.Key))
+	}
+	if !cfg.Wikimedia.Disabled {
+		apiWikimedia := NewWikimediaApi(cfg, reqCache)
+		apis = append(apis, &apiWikimedia)
+		slog.Info("Configured commons.wikimedia.org")
+	}
+	for _, provider := range cfg.Providers {
+		apiGeneric, err := NewGenericApi(cfg, provider, reqCache)
+		for _, api := range apis {
+			if err == nil && api.Type() == provider.Name {
+				err = errors.New("name is already in use")
+			}
 		}
-		lineLen += len(line)
-		if line[len(line)-1] == '\n' {
-			p.line += 1
-			p.pos -= lineLen
-			lineLen = 0
+		if err != nil {
+			slog.Error("Invalid provider in config", "name", provider.Name, "err", err)
+			continue
 		}
+		apis = append(apis, &apiGeneric)
+		slog.Info("Configured provider", "name", provider.Name, "url", provider.Url)
 	}
-	return p
+	return apis
 }
 
-func initApi(cfg *Config, store *Store) []ImageSearcher {
-	reqCache := NewReqCache(cfg, store)
+func initVideoApi(cfg *Config, reqCache *ReqCache) []VideoSearcher {
+	var apis []VideoSearcher
 
-	var apis []ImageSearcher
-
-	if cfg.Pixabay.Key != "" {
-		apiPixabay := NewPixabayApi(cfg, reqCache)
+	if len(cfg.Pixabay.Key) > 0 {
+		apiPixabay := NewPixabayVideoApi(cfg, reqCache)
 		apis = append(apis, &apiPixabay)
-		log.Println("Configured pixabay.com API Key")
 	}
-	if cfg.Pexels.Key != "" {
-		apiPexels := NewPexelsApi(cfg, reqCache)
+	if len(cfg.Pexels.Key) > 0 {
+		apiPexels := NewPexelsVideoApi(cfg, reqCache)
 		apis = append(apis, &apiPexels)
-		log.Println("Configured pexels.com API Key")
-	}
-	if cfg.Unsplash.AccessKey != "" {
-		apiUnsplash := NewUnsplashApi(cfg, reqCache)
-		apis = append(apis, &apiUnsplash)
-		log.Println("Configured unsplash.com API Key")
 	}
 	return apis
 }
 
+// maxPage is past the end of every provider's results, it keeps offsets from
+// overflowing
+const maxPage int64 = 100000
+
 type QueryParams struct {
-	Page   int
-	Search string
+	Page    int
+	PerPage int
+	Search  string
+	Timeout time.Duration
+	Rank    Ranking
+	Sources []string
+	Exclude []string
+	// Cursor replaces Page when the request continues from a cursor
+	Cursor *Cursor
 }
 
-func parseURL(url *url.URL) (*QueryParams, error) {
+func parseURL(cfg *Config, url *url.URL) (*QueryParams, error) {
 	p := QueryParams{
-		Page: 1,
+		Page:    1,
+		PerPage: cfg.Search.PerPage,
+		Timeout: cfg.Search.Timeout.Std(),
 	}
 	q, hasQ := url.Query()["q"]
 	if !hasQ {
@@ -119,85 +134,249 @@ func parseURL(url *url.URL) (*QueryParams, error) {
 	if p.Search == "" {
 		return nil, errors.New("query search cannot be empty")
 	}
+	if qCursor := url.Query().Get("cursor"); qCursor != "" {
+		cursor, err := decodeCursor(cfg.Search.CursorKey, qCursor)
+		if err != nil {
+			return nil, err
+		}
+		if cursor.Query != p.Search {
+			return nil, errors.New("cursor is for a different query")
+		}
+		p.Cursor = &cursor
+	}
 	qPage, hasPage := url.Query()["page"]
 	if hasPage {
 		n, err := strconv.ParseInt(qPage[0], 10, 0)
-		if err != nil {
+		switch {
+		case err != nil || n < 1:
 			p.Page = 1
-		} else {
+		case n > maxPage:
+			p.Page = int(maxPage)
+		default:
 			p.Page = int(n)
 		}
 	}
+	if qPerPage := url.Query().Get("per_page"); qPerPage != "" {
+		n, err := strconv.Atoi(qPerPage)
+		if err != nil || n <= 0 {
+			return nil, errors.New("per_page must be a positive number")
+		}
+		p.PerPage = min(n, max(1, cfg.Search.MaxPerPage))
+	}
+	if qTimeout := url.Query().Get("timeout"); qTimeout != "" {
+		timeout, err := parseTimeout(qTimeout)
+		if err != nil || timeout <= 0 {
+			return nil, errors.New("timeout must be a positive duration, e.g. 2.5 or 2500ms")
+		}
+		if limit := cfg.Search.MaxTimeout.Std(); limit > 0 && timeout > limit {
+			timeout = limit
+		}
+		p.Timeout = timeout
+	}
+	p.Sources = listParam(url.Query()["sources"])
+	p.Exclude = listParam(url.Query()["exclude"])
+	p.Rank = Ranking{
+		Strategy:    cfg.Search.Rank,
+		Weights:     cfg.Search.Weights,
+		Query:       p.Search,
+		Orientation: url.Query().Get("orientation"),
+	}
+	if p.Rank.Orientation != "" {
+		switch p.Rank.Orientation {
+		case orientationLandscape, orientationPortrait, orientationSquare:
+		default:
+			return nil, errors.New("orientation must be landscape, portrait or square")
+		}
+		p.Rank.Strategy = rankOrientation
+	}
+	if qRank := url.Query().Get("rank"); qRank != "" {
+		if !rankStrategies[qRank] {
+			return nil, errors.New("rank must be roundrobin, weighted, keyword or orientation")
+		}
+		p.Rank.Strategy = qRank
+	}
 	return &p, nil
 }
 
-func searchHandler(cfg *Config, apis []ImageSearcher) func(w http.ResponseWriter, r *http.Request) {
+// pageSize is the number of results from each provider on the page
+func (p *QueryParams) pageSize() int {
+	if p.PerPage <= 0 {
+		return PageSize
+	}
+	return p.PerPage
+}
+
+// offset is where in the provider's results the page starts
+func (p *QueryParams) offset(provider string) int {
+	if p.Cursor != nil {
+		return p.Cursor.Offsets[provider]
+	}
+	return (p.Page - 1) * p.pageSize()
+}
+
+// listParam splits comma separated query parameters, which may also be
+// repeated, into a list
+func listParam(values []string) []string {
+	var out []string
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				out = append(out, item)
+			}
+		}
+	}
+	return out
+}
+
+// parseTimeout accepts a number of seconds or a Go duration string
+func parseTimeout(value string) (time.Duration, error) {
+	if secs, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Duration(secs * float64(time.Second)), nil
+	}
+	return time.ParseDuration(value)
+}
+
+// searchImages and searchVideos adapt each kind of searcher for searchHandler
+func searchImages(meta *MetaWorker) func(ctx context.Context, api ImageSearcher, page int, query string) Found[ImageData] {
+	return func(ctx context.Context, api ImageSearcher, page int, query string) Found[ImageData] {
+		res := api.Search(ctx, page, query)
+		meta.Fill(api, res.images)
+		for i := range res.images {
+			attribute(&res.images[i])
+		}
+		return Found[ImageData]{Items: res.images, Raw: res.raw, Index: res.index, Err: res.err}
+	}
+}
+
+func searchVideos(ctx context.Context, api VideoSearcher, page int, query string) Found[VideoData] {
+	res := api.Search(ctx, page, query)
+	return Found[VideoData]{Items: res.videos, Err: res.err}
+}
+
+// searchHandler runs a search against apis, merge is applied to the combined
+// results when it is not nil
+func searchHandler[S Searcher, T any](cfg *Config, apis []S, breakers Breakers,
+	search func(ctx context.Context, api S, page int, query string) Found[T],
+	merge func(results []T) []T) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
-		query, err := parseURL(r.URL)
+		query, err := parseURL(cfg, r.URL)
 		if err != nil {
 			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprintf(w, "Query Search Parameter ?q= missing")
+			fmt.Fprint(w, err.Error())
 			return
 		}
-		chRes := make(chan ApiResult)
-
-		var reqCount int
-
-		for num, api := range apis {
-			start := 0
-			for _, src := range GetResPages(query.Page, PageSize, api.PageSize()) {
-				api := api
-				src := src
-				num := num
-				reqCount += 1
-				s := start
-				go func() {
-					chRes <- ApiResult{
-						Num:    num,
-						Page:   src,
-						Result: api.Search(src.Page, query.Search),
-						Start:  s,
-					}
-				}()
-				start += src.Last - src.First
+		active, err := selectApis(apis, query.Sources, query.Exclude)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, err.Error())
+			return
+		}
+		if query.Cursor != nil {
+			active = slices.DeleteFunc(slices.Clone(active), func(api S) bool {
+				_, more := query.Cursor.Offsets[api.Type()]
+				return !more
+			})
+			if len(active) == 0 {
+				writeResults(w, r, cfg, 1, []T{})
+				return
 			}
-
 		}
+		ctx, cancel := context.WithTimeout(r.Context(), query.Timeout)
+		defer cancel()
+
+		res := searchAll(ctx, query, active, breakers,
+			func(ctx context.Context, api S, page int) Found[T] {
+				return search(ctx, api, page, query.Search)
+			})
+		results := res.Ranked(query.Rank)
+		if merge != nil {
+			results = merge(results)
+		}
+		w.Header().Set(providerStatusHeader, formatProviderStatus(active, res.Status))
+		setNextCursor(w, r, cfg, query, active, res.Next)
+		writeResults(w, r, cfg, res.Ok, results)
+	}
+}
 
-		results := make([]ImageData, len(apis)*PageSize)
-
-		ok := 0
+// setNextCursor adds the cursor for the page after this one, unless every
+// provider has returned all its results
+func setNextCursor[S Searcher](w http.ResponseWriter, r *http.Request, cfg *Config, query *QueryParams, apis []S, next []int) {
+	cursor := Cursor{Query: query.Search, Offsets: map[string]int{}}
+	for num, api := range apis {
+		if next[num] >= 0 {
+			cursor.Offsets[api.Type()] = next[num]
+		}
+	}
+	if len(cursor.Offsets) == 0 {
+		return
+	}
+	value := encodeCursor(cfg.Search.CursorKey, cursor)
+	link := r.URL.Query()
+	link.Del("page")
+	link.Set("cursor", value)
+	w.Header().Set(nextCursorHeader, value)
+	w.Header().Set("Link", "<"+r.URL.Path+"?"+link.Encode()+`>; rel="next"`)
+}
 
-		for rq := 0; rq < reqCount; rq++ {
-			res := <-chRes
-			if res.Result.err == nil {
-				ok = ok + 1
-			}
-			first := min(len(res.Result.images), res.Page.First)
-			last := min(len(res.Result.images), res.Page.Last)
-			items := res.Result.images[first:last]
-			//println("Output", res.Start, res.Num, len(items), first, last)
-			for idx, item := range items {
-				results[(res.Start+idx)*len(apis)+res.Num] = item
+// useHandler serves /use/{provider}/{id}, telling the provider the image is
+// being used and then redirecting to the image itself
+func useHandler(apis []ImageSearcher) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		provider, id, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/use/"), "/")
+		var tracker UseTracker
+		for _, api := range apis {
+			if t, ok := api.(UseTracker); ok && api.Type() == provider {
+				tracker = t
 			}
 		}
-		body := brotli.HTTPCompressor(w, r)
-		defer body.Close()
-		if ok == 0 {
-			w.WriteHeader(http.StatusServiceUnavailable)
-			log.Println("Error connecting to upstream services")
+		if tracker == nil || id == "" {
+			http.NotFound(w, r)
 			return
 		}
-		w.Header().Set("Content-Type", "application/json")
-		enc := json.NewEncoder(body)
-		indent := ""
-		if cfg.Debug.PrettyJson {
-			indent = "  "
+		location, err := tracker.Use(r.Context(), id)
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) && statusErr.Code == http.StatusNotFound {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Error connecting to upstream service", http.StatusBadGateway)
+			return
 		}
-		enc.SetIndent("", indent)
-		enc.Encode(results)
+		http.Redirect(w, r, location, http.StatusFound)
+	}
+}
+
+// writeResults encodes the results of a search as JSON, failing the request
+// when none of the providers answered
+func writeResults[T any](w http.ResponseWriter, r *http.Request, cfg *Config, ok int, results []T) {
+	if r.Context().Err() != nil {
+		return
+	}
 
+	if ok == 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		logFrom(r.Context()).Error("Error connecting to upstream services")
+		return
+	}
+	// encode before writing anything so a failure is not sent as a 200
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	indent := ""
+	if cfg.Debug.PrettyJson {
+		indent = "  "
+	}
+	enc.SetIndent("", indent)
+	if err := enc.Encode(results); err != nil {
+		logFrom(r.Context()).Error("Error encoding results", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
 	}
+
+	w.Header().Set("Content-Type", "application/json")
+	body := brotli.HTTPCompressor(w, r)
+	defer body.Close()
+	body.Write(buf.Bytes())
 }
 
 func httpAuth(next http.HandlerFunc, testUser func(user string, pass string) bool) http.HandlerFunc {
@@ -208,6 +387,9 @@ func httpAuth(next http.HandlerFunc, testUser func(user string, pass string) boo
 				next.ServeHTTP(w, r)
 				return
 			}
+			authFailures.WithLabelValues("invalid").Inc()
+		} else {
+			authFailures.WithLabelValues("missing").Inc()
 		}
 		w.Header().Set("WWW-Authenticate", `Basic realm="restricted", charset="UTF-8"`)
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
@@ -221,54 +403,69 @@ func (cfg *Config) testAuth(user string, pass string) bool {
 }
 
 func main() {
-	cfg := Config{}
-	loadConfig(&cfg)
+	cfg := defaultConfig()
+	parseFlags(&cfg)
+	slog.SetDefault(newLogger(&cfg))
+	if cfg.Search.CursorKey == "" {
+		cfg.Search.CursorKey = newCursorKey()
+	}
 
-	store := NewStore(&cfg)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	apis := initApi(&cfg, store)
+	store := NewStore(&cfg)
+	reqCache := NewReqCache(&cfg, store)
+	meta := NewMetaWorker(&cfg, store)
+
+	apis := initApi(&cfg, reqCache)
+	videoApis := initVideoApi(&cfg, reqCache)
+	breakers := NewBreakers(&cfg, apis)
+	for name, breaker := range NewBreakers(&cfg, videoApis) {
+		breakers[name] = breaker
+	}
+	health := NewHealth(ctx, &cfg, store, apis, breakers)
+	registerStoreMetrics(store)
 
 	defRoute := func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusNotFound)
 		fmt.Fprint(w, "Not Found")
 	}
-	search := httpAuth(searchHandler(&cfg, apis), store.TestUser)
-	go func() {
-		if _, err := os.Stat("sock/fcgi.sock"); os.IsNotExist(err) {
-			os.Mkdir("sock", 0755)
-		} else {
-			os.Remove("sock/fcgi.sock")
-		}
-		fcgid := http.NewServeMux()
-		fcgid.HandleFunc("/", defRoute)
-		fcgid.HandleFunc("/search", search)
-
-		sock, err := net.Listen("unix", "sock/fcgi.sock")
-		if err != nil {
-			log.Panicln("Unable to open socket", err.Error())
-		}
-		err = os.Chmod("sock/fcgi.sock", 0777)
-		if err != nil {
-			log.Panicln("Unable to set socket to globally writable", err.Error())
-		}
-		log.Println("Starting FastCGI Server on sock/fcgi.sock")
-		err = fcgi.Serve(sock, fcgid)
-		if err != nil {
-			log.Panicln("Unable to bind to socket", err.Error())
+	search := httpAuth(searchHandler(&cfg, apis, breakers, searchImages(meta), dedupeImages(&cfg)), store.TestUser)
+	videos := httpAuth(searchHandler(&cfg, videoApis, breakers, searchVideos, nil), store.TestUser)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", defRoute)
+	mux.HandleFunc("/search", instrument("search", search))
+	mux.HandleFunc("/search/videos", instrument("videos", videos))
+	mux.HandleFunc("/use/", instrument("use", httpAuth(useHandler(apis), store.TestUser)))
+	mux.HandleFunc("/healthz", instrument("healthz", health.Live))
+	mux.HandleFunc("/readyz", instrument("readyz", health.Ready))
+	metrics := metricsHandler().ServeHTTP
+	if cfg.Metrics.Auth {
+		metrics = httpAuth(metrics, store.TestUser)
+	}
+	mux.HandleFunc("/metrics", metrics)
+	for _, api := range apis {
+		if library, ok := api.(*LocalLibrary); ok {
+			go library.Watch(ctx, cfg.Library.Rescan.Std())
+			original, preview := library.ServeHTTP, library.ServePreview
+			if cfg.Library.Auth {
+				original = httpAuth(original, store.TestUser)
+				preview = httpAuth(preview, store.TestUser)
+			}
+			mux.HandleFunc("/library/", instrument("library", original))
+			mux.HandleFunc("/library-previews/", instrument("library", preview))
 		}
-	}()
-
-	httpServer := http.NewServeMux()
-	httpServer.HandleFunc("/", defRoute)
-	httpServer.HandleFunc("/search", search)
-
-	log.Println("Starting HTTP Server on :8081")
-	log.Fatal(http.ListenAndServe(":8081", httpServer))
-}
+	}
+	mux.HandleFunc("/admin/quota", instrument("admin", httpAuth(quotaHandler(&cfg), store.TestAdmin)))
 
-type ApiResult struct {
-	Num    int
-	Page   PageSrc
-	Result ImageSearchResult
-	Start  int
+	err := serve(ctx, &cfg.Listen, requestLogger(mux))
+	reqCache.Close()
+	meta.Close()
+	store.Close()
+	if err != nil {
+		slog.Error("Server failed", "err", err)
+		os.Exit(1)
+	}
+	slog.Info("Shutdown complete")
 }
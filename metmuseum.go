@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+type MetSearchResult struct {
+	Total     int   `json:"total"`
+	ObjectIds []int `json:"objectIDs"`
+}
+
+type MetObject struct {
+	ObjectId          int      `json:"objectID"`
+	IsPublicDomain    bool     `json:"isPublicDomain"`
+	PrimaryImage      string   `json:"primaryImage"`
+	PrimaryImageSmall string   `json:"primaryImageSmall"`
+	Title             string   `json:"title"`
+	ArtistDisplayName string   `json:"artistDisplayName"`
+	ArtistWikidataUrl string   `json:"artistWikidata_URL"`
+	ObjectUrl         string   `json:"objectURL"`
+	Tags              []MetTag `json:"tags"`
+}
+
+type MetTag struct {
+	Term string `json:"term"`
+}
+
+// MetApi searches The Metropolitan Museum of Art open access collection. The
+// search only returns object ids, so each result needs a second request for
+// the object details. Detail requests share one limit across all searches
+type MetApi struct {
+	Http    *Upstream
+	cache   *ReqCache
+	baseUrl string
+	details chan struct{}
+}
+
+func NewMetApi(cfg *Config, cache *ReqCache) MetApi {
+	concurrency := cfg.Met.Concurrency
+	if concurrency <= 0 {
+		concurrency = 8
+	}
+	return MetApi{
+		Http:    NewUpstream("met", cfg.Http.merge(cfg.Met.Http)),
+		cache:   cache,
+		baseUrl: "https://collectionapi.metmuseum.org/public/collection/v1",
+		details: make(chan struct{}, concurrency),
+	}
+}
+
+func (api *MetApi) Type() string {
+	return "met"
+}
+
+func (api *MetApi) TTL() int {
+	return 86400
+}
+
+// PageSize is kept small as every result costs a detail request
+func (api *MetApi) PageSize() int { return 20 }
+
+func (api *MetApi) Ping(ctx context.Context) error {
+	return pingUrl(ctx, api.Http, api.baseUrl+"/departments")
+}
+
+func (api *MetApi) Search(ctx context.Context, page int, query string) ImageSearchResult {
+	log := logFrom(ctx).With("provider", api.Type())
+	qParam := url.Values{}
+	qParam.Add("q", query)
+	qParam.Add("hasImages", "true")
+	getReq, err := http.NewRequestWithContext(ctx, http.MethodGet, api.baseUrl+"/search?"+qParam.Encode(), nil)
+	if err != nil {
+		log.Error("Failed to create http request", "err", err)
+		return ImageSearchResult{err: &err, images: []ImageData{}}
+	}
+	req, err := api.cache.CachedFetch(getReq, api.Http, api.TTL())
+	if err != nil {
+		log.Error("Failed to fetch", "err", err)
+		return ImageSearchResult{err: &err, images: []ImageData{}}
+	}
+	defer req.Body.Close()
+
+	data := MetSearchResult{}
+	err = json.NewDecoder(req.Body).Decode(&data)
+	if err != nil {
+		log.Error("Failed to decode response", "err", err)
+		return ImageSearchResult{err: &err, images: []ImageData{}}
+	}
+
+	first := min(len(data.ObjectIds), (page-1)*api.PageSize())
+	last := min(len(data.ObjectIds), page*api.PageSize())
+	ids := data.ObjectIds[first:last]
+	reqs := make([]*http.Request, len(ids))
+	for i, id := range ids {
+		reqs[i], err = http.NewRequestWithContext(ctx, http.MethodGet, api.baseUrl+"/objects/"+strconv.Itoa(id), nil)
+		if err != nil {
+			log.Error("Failed to create http request", "err", err)
+			return ImageSearchResult{err: &err, images: []ImageData{}}
+		}
+	}
+	objects, errs := CachedFetchAll[MetObject](api.cache, reqs, api.Http, api.TTL(), api.details)
+
+	output := make([]ImageData, 0, len(objects))
+	index := make([]int, 0, len(objects))
+	for i, el := range objects {
+		if errs[i] != nil {
+			log.Warn("Failed to fetch object", "id", ids[i], "err", errs[i])
+			err = errs[i]
+			continue
+		}
+		// only public domain objects have images we can use
+		if !el.IsPublicDomain || el.PrimaryImageSmall == "" {
+			continue
+		}
+		tags := make([]string, len(el.Tags))
+		for t, tag := range el.Tags {
+			tags[t] = tag.Term
+		}
+		img := ImageData{
+			Id:          "met/" + strconv.Itoa(el.ObjectId),
+			Name:        el.Title,
+			Source:      "The Met",
+			SourceUrl:   el.ObjectUrl,
+			Artist:      el.ArtistDisplayName,
+			ArtistUrl:   el.ArtistWikidataUrl,
+			Licence:     "CC0 1.0",
+			LicenceUrl:  "https://creativecommons.org/publicdomain/zero/1.0/",
+			PreviewUrl:  el.PrimaryImageSmall,
+			DownloadUrl: firstNonEmpty(el.PrimaryImage, el.PrimaryImageSmall),
+		}
+		if len(tags) > 0 {
+			img.Name = el.Title + " (" + strings.Join(tags, ", ") + ")"
+		}
+		output = append(output, img)
+		index = append(index, i)
+	}
+	// only fail the search when none of the details could be fetched
+	if len(output) == 0 && err != nil {
+		return ImageSearchResult{err: &err, images: output}
+	}
+	return ImageSearchResult{err: nil, images: output, raw: len(ids), index: index}
+}
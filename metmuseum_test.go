@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetSearch(t *testing.T) {
+	var objectCalls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/search" {
+			assert.Equal(t, "true", r.URL.Query().Get("hasImages"))
+			http.ServeFile(w, r, "testdata/met_search.json")
+			return
+		}
+		objectCalls.Add(1)
+		id := strings.TrimPrefix(r.URL.Path, "/objects/")
+		http.ServeFile(w, r, "testdata/met_objects/"+id+".json")
+	}))
+	defer srv.Close()
+
+	cfg := defaultConfig()
+	cfg.Met.Http.Retries = -1
+	api := NewMetApi(&cfg, newTestCache(t))
+	api.baseUrl = srv.URL
+
+	res := api.Search(context.Background(), 1, "wheat")
+	assert.Nil(t, res.err, "A missing object does not fail the search")
+	assert.Equal(t, int32(4), objectCalls.Load())
+	assert.Equal(t, 2, len(res.images), "Objects that are not public domain are skipped")
+
+	img := res.images[0]
+	assert.Equal(t, "met/436535", img.Id)
+	assert.Equal(t, "Wheat Field with Cypresses (Landscapes, Cypresses)", img.Name)
+	assert.Equal(t, "Vincent van Gogh", img.Artist)
+	assert.Equal(t, "https://www.wikidata.org/wiki/Q5582", img.ArtistUrl)
+	assert.Equal(t, "CC0 1.0", img.Licence)
+	assert.Contains(t, img.PreviewUrl, "web-large")
+	assert.Contains(t, img.DownloadUrl, "original")
+
+	img = res.images[1]
+	assert.Equal(t, "Quail and Millet", img.Name)
+	assert.Equal(t, img.PreviewUrl, img.DownloadUrl, "Falls back to the small image")
+
+	res = api.Search(context.Background(), 1, "wheat")
+	assert.Equal(t, 2, len(res.images))
+	assert.Equal(t, int32(5), objectCalls.Load(), "Only the failed object is fetched again")
+
+	res = api.Search(context.Background(), 2, "wheat")
+	assert.Nil(t, res.err)
+	assert.Equal(t, 0, len(res.images), "Page past the end is empty")
+}
+
+func TestMetDetailLimit(t *testing.T) {
+	var inFlight, most atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/search" {
+			http.ServeFile(w, r, "testdata/met_search.json")
+			return
+		}
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for m := most.Load(); n > m && !most.CompareAndSwap(m, n); m = most.Load() {
+		}
+		time.Sleep(20 * time.Millisecond)
+		http.ServeFile(w, r, "testdata/met_objects/"+strings.TrimPrefix(r.URL.Path, "/objects/")+".json")
+	}))
+	defer srv.Close()
+
+	cfg := defaultConfig()
+	cfg.Met.Concurrency = 2
+	cfg.Met.Http.Retries = -1
+	api := NewMetApi(&cfg, newTestCache(t))
+	api.baseUrl = srv.URL
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// separate caches so every search fetches the details
+			search := api
+			search.cache = newTestCache(t)
+			search.Search(context.Background(), 1, "wheat"+strconv.Itoa(i))
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, int32(2), most.Load(), "The limit covers all searches together")
+}
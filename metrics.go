@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const metricsNamespace string = "stockimgproxy"
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_requests_total",
+		Help:      "Requests served by route and status code",
+	}, []string{"route", "code"})
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Request latency by route and status code",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "code"})
+
+	upstreamRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "upstream_requests_total",
+		Help:      "Searches made against each provider",
+	}, []string{"provider"})
+	upstreamErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "upstream_errors_total",
+		Help:      "Searches against each provider that returned an error",
+	}, []string{"provider"})
+	upstreamDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "upstream_duration_seconds",
+		Help:      "Search latency for each provider, including cached responses",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"provider"})
+
+	cacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "cache_lookups_total",
+		Help:      "Request cache lookups by result (hit, miss, stale)",
+	}, []string{"result"})
+
+	circuitState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "circuit_state",
+		Help:      "Circuit breaker state for each provider (0 closed, 1 open, 2 half-open)",
+	}, []string{"provider"})
+
+	authFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "auth_failures_total",
+		Help:      "Rejected requests by reason (missing, invalid)",
+	}, []string{"reason"})
+)
+
+// registerStoreMetrics exports the size of the sqlite response cache, the
+// values are read from the database on each scrape
+func registerStoreMetrics(store *Store) {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "cache_entries",
+		Help:      "Responses held in the sqlite cache",
+	}, func() float64 {
+		entries, _ := store.CacheSize()
+		return float64(entries)
+	})
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "cache_bytes",
+		Help:      "Size of the responses held in the sqlite cache",
+	}, func() float64 {
+		_, size := store.CacheSize()
+		return float64(size)
+	})
+}
+
+func metricsHandler() http.Handler {
+	return promhttp.Handler()
+}
+
+func instrument(route string, next http.HandlerFunc) http.HandlerFunc {
+	labels := prometheus.Labels{"route": route}
+	h := promhttp.InstrumentHandlerDuration(httpDuration.MustCurryWith(labels),
+		promhttp.InstrumentHandlerCounter(httpRequests.MustCurryWith(labels), next))
+	return h.ServeHTTP
+}
+
+// timedSearch runs a search against api, recording the call in the upstream
+// metrics
+func timedSearch[S Searcher, T any](ctx context.Context, api S, page int,
+	search func(ctx context.Context, api S, page int) Found[T]) Found[T] {
+	start := time.Now()
+	found := search(ctx, api, page)
+	provider := api.Type()
+	upstreamRequests.WithLabelValues(provider).Inc()
+	upstreamDuration.WithLabelValues(provider).Observe(time.Since(start).Seconds())
+	if found.Err != nil {
+		upstreamErrors.WithLabelValues(provider).Inc()
+	}
+	return found
+}
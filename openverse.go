@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+type OpenverseImage struct {
+	Id                string         `json:"id"`
+	Title             string         `json:"title"`
+	ForeignLandingUrl string         `json:"foreign_landing_url"`
+	Url               string         `json:"url"`
+	Thumbnail         string         `json:"thumbnail"`
+	Creator           string         `json:"creator"`
+	CreatorUrl        string         `json:"creator_url"`
+	License           string         `json:"license"`
+	LicenseVersion    string         `json:"license_version"`
+	LicenseUrl        string         `json:"license_url"`
+	Source            string         `json:"source"`
+	Attribution       string         `json:"attribution"`
+	Width             float32        `json:"width"`
+	Height            float32        `json:"height"`
+	Tags              []OpenverseTag `json:"tags"`
+}
+
+type OpenverseTag struct {
+	Name string `json:"name"`
+}
+
+type OpenverseSearchResult struct {
+	ResultCount int              `json:"result_count"`
+	PageCount   int              `json:"page_count"`
+	Page        int              `json:"page"`
+	Results     []OpenverseImage `json:"results"`
+}
+
+type OpenverseApi struct {
+	Http        *Upstream
+	cache       *ReqCache
+	baseUrl     string
+	licenseType string
+}
+
+func NewOpenverseApi(cfg *Config, cache *ReqCache) OpenverseApi {
+	return OpenverseApi{
+		Http:        NewUpstream("openverse", cfg.Http.merge(cfg.Openverse.Http)),
+		cache:       cache,
+		baseUrl:     "https://api.openverse.org/v1/images/",
+		licenseType: cfg.Openverse.LicenseType,
+	}
+}
+
+func (api *OpenverseApi) Type() string {
+	return "openverse"
+}
+
+func (api *OpenverseApi) TTL() int {
+	return 86400
+}
+
+// PageSize is the most Openverse allows for anonymous requests
+func (api *OpenverseApi) PageSize() int { return 20 }
+
+func (api *OpenverseApi) Ping(ctx context.Context) error {
+	return pingUrl(ctx, api.Http, api.baseUrl)
+}
+
+func (api *OpenverseApi) Search(ctx context.Context, page int, query string) ImageSearchResult {
+	log := logFrom(ctx).With("provider", api.Type())
+	qParam := url.Values{}
+	qParam.Add("q", query)
+	qParam.Add("page", strconv.Itoa(page))
+	qParam.Add("page_size", strconv.Itoa(api.PageSize()))
+	if api.licenseType != "" {
+		qParam.Add("license_type", api.licenseType)
+	}
+	getReq, err := http.NewRequestWithContext(ctx, http.MethodGet, api.baseUrl+"?"+qParam.Encode(), nil)
+	if err != nil {
+		log.Error("Failed to create http request", "err", err)
+		return ImageSearchResult{err: &err, images: []ImageData{}}
+	}
+	req, err := api.cache.CachedFetch(getReq, api.Http, api.TTL())
+	if err != nil {
+		log.Error("Failed to fetch", "err", err)
+		return ImageSearchResult{err: &err, images: []ImageData{}}
+	}
+	defer req.Body.Close()
+
+	data := OpenverseSearchResult{}
+	err = json.NewDecoder(req.Body).Decode(&data)
+	if err != nil {
+		log.Error("Failed to decode response", "err", err)
+		return ImageSearchResult{err: &err, images: []ImageData{}}
+	}
+	output := make([]ImageData, len(data.Results))
+	for i, el := range data.Results {
+		tags := make([]string, len(el.Tags))
+		for t, tag := range el.Tags {
+			tags[t] = tag.Name
+		}
+		output[i].Id = "openverse/" + el.Id
+		output[i].Name = el.Title
+		if len(tags) > 0 {
+			output[i].Name = strings.Join(tags, ", ")
+		}
+		output[i].Source = "Openverse"
+		output[i].SourceUrl = el.ForeignLandingUrl
+		output[i].Artist = el.Creator
+		output[i].ArtistUrl = el.CreatorUrl
+		output[i].Licence = openverseLicence(el.License, el.LicenseVersion)
+		output[i].LicenceUrl = el.LicenseUrl
+		output[i].Attribution = el.Attribution
+		output[i].setSize(el.Width, el.Height)
+		output[i].DownloadUrl = el.Url
+		output[i].PreviewUrl = el.Thumbnail
+		if output[i].PreviewUrl == "" {
+			output[i].PreviewUrl = el.Url
+		}
+	}
+	return ImageSearchResult{err: nil, images: output}
+}
+
+// openverseLicence turns the licence code and version into its usual name,
+// e.g. "by-sa" and "4.0" become "CC BY-SA 4.0"
+func openverseLicence(license string, version string) string {
+	switch license {
+	case "":
+		return ""
+	case "cc0":
+		return "CC0 " + version
+	case "pdm":
+		return "Public Domain Mark " + version
+	}
+	return strings.TrimSpace("CC " + strings.ToUpper(license) + " " + version)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpenverseSearch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		assert.Equal(t, "bridge", q.Get("q"))
+		assert.Equal(t, "2", q.Get("page"))
+		assert.Equal(t, "20", q.Get("page_size"))
+		assert.Equal(t, "commercial", q.Get("license_type"))
+		http.ServeFile(w, r, "testdata/openverse_search.json")
+	}))
+	defer srv.Close()
+
+	cfg := defaultConfig()
+	api := NewOpenverseApi(&cfg, newTestCache(t))
+	api.baseUrl = srv.URL
+
+	res := api.Search(context.Background(), 2, "bridge")
+	assert.Nil(t, res.err)
+	assert.Equal(t, 2, len(res.images))
+
+	img := res.images[0]
+	assert.Equal(t, "openverse/4bc43a04-ef46-4544-a0c1-63c63f56e276", img.Id)
+	assert.Equal(t, "london, bridge", img.Name)
+	assert.Equal(t, "Jane Example", img.Artist)
+	assert.Equal(t, "https://www.flickr.com/photos/example", img.ArtistUrl)
+	assert.Equal(t, "CC BY-SA 2.0", img.Licence)
+	assert.Equal(t, "https://creativecommons.org/licenses/by-sa/2.0/", img.LicenceUrl)
+	assert.Contains(t, img.Attribution, "licensed under CC BY-SA 2.0")
+	assert.InDelta(t, 1.333, img.Aspect, 0.001)
+	assert.Equal(t, "https://live.staticflickr.com/65535/123456_abcdef_b.jpg", img.DownloadUrl)
+
+	img = res.images[1]
+	assert.Equal(t, "Old lighthouse", img.Name, "Title is used when there are no tags")
+	assert.Equal(t, "CC0 1.0", img.Licence)
+	assert.Equal(t, float32(0), img.Aspect, "Zero height does not give NaN")
+	assert.Equal(t, img.DownloadUrl, img.PreviewUrl, "Falls back to the full image without a thumbnail")
+}
@@ -2,6 +2,8 @@ package main
 
 import "fmt"
 
+// PageSize is the number of results from each provider on a page when the
+// request does not ask for another with per_page
 const PageSize int = 25
 
 type PageSrc struct {
@@ -17,28 +19,26 @@ func min(a, b int) int {
 	return b
 }
 
+// GetResPages lists the provider pages, of resPageSize results each, that
+// hold page srcPage of our results
 func GetResPages(srcPage int, srcPageSize int, resPageSize int) []PageSrc {
-	var startOffset = (srcPage - 1) * srcPageSize
-	var endOffset = startOffset + srcPageSize
-	var firstPage = 1 + (startOffset / resPageSize)
-	var first = (firstPage - 1) * resPageSize
-	var last = first + resPageSize
-	//println("Output Offset:", startOffset, endOffset)
-	//println("First Res ", first, last)
-	pages := []PageSrc{{
-		Page:  firstPage,
-		First: startOffset - first,
-		Last:  min(resPageSize, endOffset-first),
-	}}
-	for last < endOffset {
-		remain := endOffset - (last / resPageSize * resPageSize)
-		last += resPageSize
-		lastPage := last / resPageSize
+	return GetResRange((srcPage-1)*srcPageSize, srcPageSize, resPageSize)
+}
+
+// GetResRange lists the provider pages, of resPageSize results each, that
+// hold the count results starting at offset, with the range of each page used
+func GetResRange(offset int, count int, resPageSize int) []PageSrc {
+	var pages []PageSrc
+	end := offset + count
+	for pos := offset; pos < end; {
+		page := pos / resPageSize
+		start := page * resPageSize
 		pages = append(pages, PageSrc{
-			Page:  lastPage,
-			First: 0,
-			Last:  min(resPageSize, remain),
+			Page:  page + 1,
+			First: pos - start,
+			Last:  min(resPageSize, end-start),
 		})
+		pos = start + resPageSize
 	}
 	return pages
 }
@@ -1,8 +1,13 @@
 package main
 
 import (
-	"github.com/stretchr/testify/assert"
+	"context"
+	"net/url"
+	"strconv"
 	"testing"
+	"testing/quick"
+
+	"github.com/stretchr/testify/assert"
 )
 
 func TestPageOffset(t *testing.T) {
@@ -64,3 +69,108 @@ func TestPageOffset3(t *testing.T) {
 	assert.Equal(t, 0, list[1].First)
 	assert.Equal(t, 80, list[1].Last)
 }
+
+func TestPageOffsetLargeSource(t *testing.T) {
+	//   Flickr returns up to 500 per page, so 20 of our pages come from one
+	list := GetResPages(20, 25, 500)
+	assert.Equal(t, 1, len(list))
+	assert.Equal(t, 1, list[0].Page)
+	assert.Equal(t, 475, list[0].First)
+	assert.Equal(t, 500, list[0].Last)
+
+	list = GetResPages(21, 25, 500)
+	assert.Equal(t, 1, len(list))
+	assert.Equal(t, 2, list[0].Page)
+	assert.Equal(t, 0, list[0].First)
+	assert.Equal(t, 25, list[0].Last)
+}
+
+func TestResRange(t *testing.T) {
+	list := GetResRange(10, 25, 30)
+	assert.Equal(t, []PageSrc{{Page: 1, First: 10, Last: 30}, {Page: 2, First: 0, Last: 5}}, list)
+	assert.Equal(t, 0, len(GetResRange(10, 0, 30)))
+}
+
+// Every result of a provider is on exactly one of our pages, in order, for any
+// page size of ours and of the provider
+func TestPagesProperty(t *testing.T) {
+	prop := func(perPage uint8, resPageSize uint16, pages uint8) bool {
+		size := int(perPage)%150 + 1
+		resSize := int(resPageSize)%600 + 1
+		next := 0
+		for page := 1; page <= int(pages)%40+1; page++ {
+			for _, src := range GetResPages(page, size, resSize) {
+				if src.First < 0 || src.First >= src.Last || src.Last > resSize {
+					return false
+				}
+				for i := src.First; i < src.Last; i++ {
+					if (src.Page-1)*resSize+i != next {
+						return false
+					}
+					next++
+				}
+			}
+			if next != page*size {
+				return false
+			}
+		}
+		return true
+	}
+	assert.NoError(t, quick.Check(prop, &quick.Config{MaxCount: 2000}))
+
+	// any page a client asks for starts at a valid offset
+	cfg := defaultConfig()
+	apis := []*fakeSearcher{{name: "a", pageSize: 30, total: 100}}
+	breakers := NewBreakers(&cfg, apis)
+	valid := func(page int64, perPage uint8) bool {
+		u, _ := url.Parse("/search?q=cat&page=" + strconv.FormatInt(page, 10) + "&per_page=" + strconv.Itoa(int(perPage)%100+1))
+		query, err := parseURL(&cfg, u)
+		if err != nil || query.Page < 1 || query.offset("a") < 0 {
+			return false
+		}
+		searchAll(context.Background(), query, apis, breakers, fakeSearch)
+		return true
+	}
+	assert.NoError(t, quick.Check(valid, &quick.Config{MaxCount: 500}))
+	for _, page := range []int64{0, -1, -25} {
+		assert.True(t, valid(page, 24), page)
+	}
+}
+
+// Paging through a search returns every result of every provider once, for
+// any per_page and provider page sizes
+func TestSearchPagesProperty(t *testing.T) {
+	cfg := defaultConfig()
+	prop := func(perPage uint8, sizes [3]uint8, totals [3]uint8) bool {
+		var apis []*fakeSearcher
+		want := map[string]bool{}
+		for i, name := range []string{"a", "b", "c"} {
+			api := &fakeSearcher{name: name, pageSize: int(sizes[i])%50 + 1, total: int(totals[i])}
+			apis = append(apis, api)
+			all := fakeSearch(context.Background(), &fakeSearcher{name: name, pageSize: api.total, total: api.total}, 1)
+			for _, item := range all.Items {
+				want[item] = true
+			}
+		}
+		breakers := NewBreakers(&cfg, apis)
+		query := &QueryParams{PerPage: int(perPage)%120 + 1}
+		seen := map[string]bool{}
+		for query.Page = 1; ; query.Page++ {
+			results := searchAll(context.Background(), query, apis, breakers, fakeSearch).Results()
+			if len(results) == 0 {
+				break
+			}
+			if len(results) > len(apis)*query.PerPage {
+				return false
+			}
+			for _, item := range results {
+				if seen[item] || !want[item] {
+					return false
+				}
+				seen[item] = true
+			}
+		}
+		return len(seen) == len(want)
+	}
+	assert.NoError(t, quick.Check(prop, &quick.Config{MaxCount: 200}))
+}
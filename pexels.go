@@ -1,28 +1,35 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
-	"log"
 	"net/http"
 	"net/url"
-	"os"
 	"strconv"
 )
 
 type PexelsPhoto struct {
-	Id             int            `json:"id"`
-	Width          float32        `json:"width"`
-	Height         float32        `json:"height"`
-	Url            string         `json:"url"`
-	Alt            string         `json:"alt"`
-	Photographer   string         `json:"photographer"`
-	PhotographerId int            `json:"photographer_id"`
-	Src            PexelsPhotoSrc `json:"src"`
+	Id              int            `json:"id"`
+	Width           float32        `json:"width"`
+	Height          float32        `json:"height"`
+	Url             string         `json:"url"`
+	Alt             string         `json:"alt"`
+	AvgColor        string         `json:"avg_color"`
+	Photographer    string         `json:"photographer"`
+	PhotographerId  int            `json:"photographer_id"`
+	PhotographerUrl string         `json:"photographer_url"`
+	Src             PexelsPhotoSrc `json:"src"`
 }
 
 type PexelsPhotoSrc struct {
-	Original string `json:"original"`
-	Large    string `json:"large"`
+	Original  string `json:"original"`
+	Large2x   string `json:"large2x"`
+	Large     string `json:"large"`
+	Medium    string `json:"medium"`
+	Small     string `json:"small"`
+	Portrait  string `json:"portrait"`
+	Landscape string `json:"landscape"`
+	Tiny      string `json:"tiny"`
 }
 
 type PexelsSearchResult struct {
@@ -33,19 +40,19 @@ type PexelsSearchResult struct {
 }
 
 type PexelsApi struct {
-	Http    http.Client
+	Http    *Upstream
 	cache   *ReqCache
-	apiKey  string
 	baseUrl string
-	log     *log.Logger
 }
 
 func NewPexelsApi(cfg *Config, cache *ReqCache) PexelsApi {
 	return PexelsApi{
-		apiKey:  cfg.Pexels.Key,
+		Http: NewUpstream("pexels", cfg.Http.merge(cfg.Pexels.Http)).WithKeys(cfg.Pexels.Key,
+			func(req *http.Request, key string) {
+				req.Header.Set("Authorization", key)
+			}),
 		cache:   cache,
 		baseUrl: "https://api.pexels.com/v1/search",
-		log:     log.New(os.Stderr, "(pexels)", log.LstdFlags),
 	}
 }
 
@@ -59,21 +66,24 @@ func (api *PexelsApi) TTL() int {
 
 func (api *PexelsApi) PageSize() int { return 80 }
 
-func (api *PexelsApi) Search(Page int, query string) ImageSearchResult {
+func (api *PexelsApi) Ping(ctx context.Context) error {
+	return pingUrl(ctx, api.Http, api.baseUrl)
+}
+
+func (api *PexelsApi) Search(ctx context.Context, Page int, query string) ImageSearchResult {
+	log := logFrom(ctx).With("provider", api.Type())
 	qParam := url.Values{}
-	qParam.Add("key", api.apiKey)
 	qParam.Add("query", query)
 	qParam.Add("page", strconv.Itoa(Page))
 	qParam.Add("per_page", strconv.Itoa(api.PageSize()))
-	getReq, err := http.NewRequest(http.MethodGet, api.baseUrl+"?"+qParam.Encode(), nil)
+	getReq, err := http.NewRequestWithContext(ctx, http.MethodGet, api.baseUrl+"?"+qParam.Encode(), nil)
 	if err != nil {
-		api.log.Println("Failed to create http request:", err)
+		log.Error("Failed to create http request", "err", err)
 		return ImageSearchResult{err: &err, images: []ImageData{}}
 	}
-	getReq.Header.Set("Authorization", api.apiKey)
-	req, err := api.cache.CachedFetch(getReq, &api.Http)
+	req, err := api.cache.CachedFetch(getReq, api.Http, api.TTL())
 	if err != nil {
-		api.log.Println("Failed to fetch:", err)
+		log.Error("Failed to fetch", "err", err)
 		return ImageSearchResult{err: &err, images: []ImageData{}}
 	}
 	defer req.Body.Close()
@@ -81,7 +91,7 @@ func (api *PexelsApi) Search(Page int, query string) ImageSearchResult {
 	data := PexelsSearchResult{}
 	err = json.NewDecoder(req.Body).Decode(&data)
 	if err != nil {
-		api.log.Println("Failed to decode response", err)
+		log.Error("Failed to decode response", "err", err)
 		return ImageSearchResult{err: &err, images: []ImageData{}}
 	}
 	output := make([]ImageData, len(data.Photos))
@@ -91,9 +101,21 @@ func (api *PexelsApi) Search(Page int, query string) ImageSearchResult {
 		output[i].Source = "Pexels"
 		output[i].SourceUrl = el.Url
 		output[i].Artist = el.Photographer
-		output[i].Aspect = el.Width / el.Height
+		output[i].ArtistUrl = el.PhotographerUrl
+		output[i].Licence = "Pexels License"
+		output[i].LicenceUrl = "https://www.pexels.com/license/"
+		output[i].setSize(el.Width, el.Height)
+		output[i].Color = el.AvgColor
 		output[i].DownloadUrl = el.Src.Original
 		output[i].PreviewUrl = el.Src.Large
+		// tiny, portrait and landscape are cropped so are left out
+		output[i].Renditions = renditions(
+			fitRendition(el.Src.Small, el.Width, el.Height, 0, 130),
+			fitRendition(el.Src.Medium, el.Width, el.Height, 0, 350),
+			fitRendition(el.Src.Large, el.Width, el.Height, 940, 650),
+			fitRendition(el.Src.Large2x, el.Width, el.Height, 1880, 1300),
+			fitRendition(el.Src.Original, el.Width, el.Height, 0, 0),
+		)
 	}
 	return ImageSearchResult{err: nil, images: output}
 }
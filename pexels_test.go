@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPexelsSearch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "test-key", r.Header.Get("Authorization"))
+		http.ServeFile(w, r, "testdata/pexels_search.json")
+	}))
+	defer srv.Close()
+
+	cfg := defaultConfig()
+	cfg.Pexels.Key = KeyList{"test-key"}
+	api := NewPexelsApi(&cfg, newTestCache(t))
+	api.baseUrl = srv.URL
+
+	res := api.Search(context.Background(), 1, "rocks")
+	assert.Nil(t, res.err)
+	assert.Equal(t, 1, len(res.images))
+
+	img := res.images[0]
+	assert.Equal(t, "https://www.pexels.com/@joey", img.ArtistUrl)
+	assert.Equal(t, "Pexels License", img.Licence)
+	assert.Equal(t, "#978E82", img.Color)
+	assert.Equal(t, []Rendition{
+		{130, 130, img.Renditions[0].Url},
+		{350, 350, img.Renditions[1].Url},
+		{650, 650, img.Renditions[2].Url},
+		{1300, 1300, img.Renditions[3].Url},
+		{3024, 3024, img.DownloadUrl},
+	}, img.Renditions)
+	assert.Contains(t, img.Renditions[0].Url, "h=130")
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+type PexelsVideo struct {
+	Id         int               `json:"id"`
+	Width      float32           `json:"width"`
+	Height     float32           `json:"height"`
+	Url        string            `json:"url"`
+	Image      string            `json:"image"`
+	Duration   int               `json:"duration"`
+	User       PexelsVideoUser   `json:"user"`
+	VideoFiles []PexelsVideoFile `json:"video_files"`
+}
+
+type PexelsVideoUser struct {
+	Id   int    `json:"id"`
+	Name string `json:"name"`
+	Url  string `json:"url"`
+}
+
+type PexelsVideoFile struct {
+	Id       int    `json:"id"`
+	Quality  string `json:"quality"`
+	FileType string `json:"file_type"`
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+	Link     string `json:"link"`
+}
+
+type PexelsVideoSearchResult struct {
+	TotalResults int           `json:"total_results"`
+	Page         int           `json:"page"`
+	PerPage      int           `json:"per_page"`
+	Videos       []PexelsVideo `json:"videos"`
+}
+
+type PexelsVideoApi struct {
+	Http    *Upstream
+	cache   *ReqCache
+	baseUrl string
+}
+
+func NewPexelsVideoApi(cfg *Config, cache *ReqCache) PexelsVideoApi {
+	return PexelsVideoApi{
+		Http: NewUpstream("pexels", cfg.Http.merge(cfg.Pexels.Http)).WithKeys(cfg.Pexels.Key,
+			func(req *http.Request, key string) {
+				req.Header.Set("Authorization", key)
+			}),
+		cache:   cache,
+		baseUrl: "https://api.pexels.com/videos/search",
+	}
+}
+
+func (api *PexelsVideoApi) Type() string {
+	return "pexels-video"
+}
+
+func (api *PexelsVideoApi) TTL() int {
+	return 86400
+}
+
+func (api *PexelsVideoApi) PageSize() int { return 80 }
+
+func (api *PexelsVideoApi) Search(ctx context.Context, page int, query string) VideoSearchResult {
+	log := logFrom(ctx).With("provider", api.Type())
+	qParam := url.Values{}
+	qParam.Add("query", query)
+	qParam.Add("page", strconv.Itoa(page))
+	qParam.Add("per_page", strconv.Itoa(api.PageSize()))
+	getReq, err := http.NewRequestWithContext(ctx, http.MethodGet, api.baseUrl+"?"+qParam.Encode(), nil)
+	if err != nil {
+		log.Error("Failed to create http request", "err", err)
+		return VideoSearchResult{err: &err, videos: []VideoData{}}
+	}
+	req, err := api.cache.CachedFetch(getReq, api.Http, api.TTL())
+	if err != nil {
+		log.Error("Failed to fetch", "err", err)
+		return VideoSearchResult{err: &err, videos: []VideoData{}}
+	}
+	defer req.Body.Close()
+
+	data := PexelsVideoSearchResult{}
+	err = json.NewDecoder(req.Body).Decode(&data)
+	if err != nil {
+		log.Error("Failed to decode response", "err", err)
+		return VideoSearchResult{err: &err, videos: []VideoData{}}
+	}
+	output := make([]VideoData, len(data.Videos))
+	for i, el := range data.Videos {
+		output[i].Id = "pexels/video/" + strconv.Itoa(el.Id)
+		output[i].Source = "Pexels"
+		output[i].SourceUrl = el.Url
+		output[i].Artist = el.User.Name
+		output[i].ArtistUrl = el.User.Url
+		output[i].Duration = el.Duration
+		if el.Height > 0 {
+			output[i].Aspect = el.Width / el.Height
+		}
+		output[i].PosterUrl = el.Image
+		output[i].Renditions = make([]VideoRendition, 0, len(el.VideoFiles))
+		for _, file := range el.VideoFiles {
+			output[i].Renditions = append(output[i].Renditions, VideoRendition{
+				Quality:  file.Quality,
+				Width:    file.Width,
+				Height:   file.Height,
+				FileType: file.FileType,
+				Url:      file.Link,
+			})
+		}
+		sortRenditions(output[i].Renditions)
+	}
+	return VideoSearchResult{err: nil, videos: output}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPexelsVideoSearch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "test-key", r.Header.Get("Authorization"))
+		assert.Equal(t, "waves", r.URL.Query().Get("query"))
+		assert.Equal(t, "80", r.URL.Query().Get("per_page"))
+		http.ServeFile(w, r, "testdata/pexels_videos.json")
+	}))
+	defer srv.Close()
+
+	cfg := defaultConfig()
+	cfg.Pexels.Key = KeyList{"test-key"}
+	api := NewPexelsVideoApi(&cfg, newTestCache(t))
+	api.baseUrl = srv.URL
+
+	res := api.Search(context.Background(), 1, "waves")
+	assert.Nil(t, res.err)
+	assert.Equal(t, 2, len(res.videos))
+
+	video := res.videos[0]
+	assert.Equal(t, "pexels/video/856787", video.Id)
+	assert.Equal(t, "Jane Example", video.Artist)
+	assert.Equal(t, "https://www.pexels.com/@jane", video.ArtistUrl)
+	assert.Equal(t, 18, video.Duration)
+	assert.Equal(t, float32(1920)/float32(1080), video.Aspect)
+	assert.Equal(t, "https://images.pexels.com/videos/856787/free-video-856787.jpg", video.PosterUrl)
+	assert.Equal(t, 3, len(video.Renditions))
+	assert.Equal(t, "video/hls", video.Renditions[0].FileType, "Renditions without a size sort first")
+	assert.Equal(t, "sd", video.Renditions[1].Quality)
+	assert.Equal(t, 1920, video.Renditions[2].Width)
+
+	assert.Equal(t, 0, len(res.videos[1].Renditions))
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"math/bits"
+	"strconv"
+)
+
+// dHash is the difference hash of img as 16 hex digits. The image is reduced
+// to 9x8 cells of luminance and each bit records whether a cell is brighter
+// than its right neighbour, so resized or recompressed copies of a photo hash
+// to the same or nearly the same value
+func dHash(img image.Image) string {
+	pixels, w, h := linearPixels(img)
+	var hash uint64
+	for cy := 0; cy < 8; cy++ {
+		var row [9]float64
+		y0, y1 := cellRange(cy, 8, h)
+		for cx := 0; cx < 9; cx++ {
+			x0, x1 := cellRange(cx, 9, w)
+			var sum float64
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					p := pixels[y*w+x]
+					sum += 0.2126*p[0] + 0.7152*p[1] + 0.0722*p[2]
+				}
+			}
+			row[cx] = sum / float64((x1-x0)*(y1-y0))
+		}
+		for cx := 0; cx < 8; cx++ {
+			hash <<= 1
+			if row[cx] > row[cx+1] {
+				hash |= 1
+			}
+		}
+	}
+	return fmt.Sprintf("%016x", hash)
+}
+
+// cellRange is the pixels covered by cell n of cells along a side of size
+// pixels, at least one pixel even when the side is smaller than cells
+func cellRange(n int, cells int, size int) (int, int) {
+	first := min(n*size/cells, size-1)
+	return first, max(first+1, (n+1)*size/cells)
+}
+
+// hashDistance is the number of bits that differ between two hashes, or -1
+// when either is missing
+func hashDistance(a string, b string) int {
+	x, errA := strconv.ParseUint(a, 16, 64)
+	y, errB := strconv.ParseUint(b, 16, 64)
+	if errA != nil || errB != nil {
+		return -1
+	}
+	return bits.OnesCount64(x ^ y)
+}
+
+// dedupeAspect is how far apart the aspect ratios of two images with close
+// hashes may be, crops of a photo hash alike but are not duplicates
+const dedupeAspect float64 = 0.05
+
+// dedupeImages returns the merge step that collapses near duplicates, the
+// first occurrence is kept and the others are listed as its alternates
+func dedupeImages(cfg *Config) func(images []ImageData) []ImageData {
+	if cfg.Search.Dedupe.Disabled {
+		return nil
+	}
+	distance := cfg.Search.Dedupe.Distance
+	return func(images []ImageData) []ImageData {
+		out := make([]ImageData, 0, len(images))
+	next:
+		for _, img := range images {
+			for i := range out {
+				if isDuplicate(&out[i], &img, distance) {
+					out[i].Alternates = append(out[i].Alternates, img)
+					continue next
+				}
+			}
+			out = append(out, img)
+		}
+		return out
+	}
+}
+
+func isDuplicate(a *ImageData, b *ImageData, distance int) bool {
+	if a.Source == b.Source {
+		return false
+	}
+	d := hashDistance(a.DHash, b.DHash)
+	if d < 0 || d > distance {
+		return false
+	}
+	if a.Aspect > 0 && b.Aspect > 0 {
+		return math.Abs(float64(a.Aspect-b.Aspect))/float64(a.Aspect) <= dedupeAspect
+	}
+	return true
+}
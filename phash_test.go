@@ -0,0 +1,66 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func gradientImage(width int, height int, invert bool) image.Image {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			v := uint8((x*7 + y*3) * 255 / (width*7 + height*3))
+			if invert {
+				v = 255 - v
+			}
+			img.Set(x, y, color.Gray{v})
+		}
+	}
+	return img
+}
+
+func TestDHash(t *testing.T) {
+	hash := dHash(gradientImage(300, 200, false))
+	assert.Equal(t, "0000000000000000", hash, "Brightening to the right sets no bits")
+	assert.Equal(t, hash, dHash(gradientImage(90, 60, false)), "Resized copies hash alike")
+	assert.Equal(t, "ffffffffffffffff", dHash(gradientImage(300, 200, true)))
+	assert.Equal(t, 16, len(dHash(gradientImage(3, 2, false))), "Images smaller than the grid")
+
+	assert.Equal(t, 0, hashDistance(hash, hash))
+	assert.Equal(t, 64, hashDistance("0000000000000000", "ffffffffffffffff"))
+	assert.Equal(t, 2, hashDistance("0000000000000000", "0000000000000011"))
+	assert.Equal(t, -1, hashDistance("", hash))
+}
+
+func TestDedupeImages(t *testing.T) {
+	cfg := defaultConfig()
+	dedupe := dedupeImages(&cfg)
+	images := []ImageData{
+		{Id: "pexels/1", Source: "pexels", Aspect: 1.5, DHash: "f0f0f0f0f0f0f0f0"},
+		{Id: "unsplash/1", Source: "unsplash", Aspect: 1.5, DHash: "f0f0f0f0f0f0f0f0"},
+		{Id: "pixabay/1", Source: "pixabay", Aspect: 1.49, DHash: "f0f0f0f0f0f0f0f3"},
+		{Id: "pixabay/2", Source: "pixabay", Aspect: 1, DHash: "f0f0f0f0f0f0f0f0"},
+		{Id: "unsplash/2", Source: "unsplash", Aspect: 1.5, DHash: "0f0f0f0f0f0f0f0f"},
+		{Id: "pexels/2", Source: "pexels", Aspect: 1.5, DHash: "0f0f0f0f0f0f0f0f"},
+		{Id: "pexels/3", Source: "pexels", Aspect: 1.5},
+		{Id: "unsplash/3", Source: "unsplash", Aspect: 1.5},
+	}
+	out := dedupe(images)
+	ids := make([]string, len(out))
+	for i, img := range out {
+		ids[i] = img.Id
+	}
+	assert.Equal(t, []string{"pexels/1", "pixabay/2", "unsplash/2", "pexels/3", "unsplash/3"}, ids)
+	assert.Equal(t, 2, len(out[0].Alternates), "Close hashes are collapsed into the first")
+	assert.Equal(t, "unsplash/1", out[0].Alternates[0].Id)
+	assert.Equal(t, "pixabay/1", out[0].Alternates[1].Id)
+	assert.Equal(t, 0, len(out[1].Alternates), "Different aspect is not a duplicate")
+	assert.Equal(t, "pexels/2", out[2].Alternates[0].Id)
+	assert.Equal(t, 0, len(out[3].Alternates), "Images without a hash are kept")
+
+	cfg.Search.Dedupe.Disabled = true
+	assert.Nil(t, dedupeImages(&cfg))
+}
@@ -1,21 +1,26 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
-	"log"
 	"net/http"
 	"net/url"
-	"os"
 	"strconv"
 )
 
 type PixabaySearchItem struct {
 	Id              int     `json:"id"`
 	Tags            string  `json:"tags"`
+	PreviewUrl      string  `json:"previewURL"`
+	PreviewWidth    float32 `json:"previewWidth"`
+	PreviewHeight   float32 `json:"previewHeight"`
 	WebFormatUrl    string  `json:"webformatURL"`
 	WebFormatWidth  float32 `json:"webformatWidth"`
 	WebFormatHeight float32 `json:"webformatHeight"`
+	LargeImageUrl   string  `json:"largeImageURL"`
 	ImageUrl        string  `json:"imageURL"`
+	ImageWidth      float32 `json:"imageWidth"`
+	ImageHeight     float32 `json:"imageHeight"`
 	UserId          int     `json:"user_id"`
 	User            string  `json:"user"`
 	PageUrl         string  `json:"pageURL"`
@@ -28,17 +33,21 @@ type PixabaySearchResult struct {
 }
 
 type PixabayApi struct {
-	Http   http.Client
-	cache  *ReqCache
-	apiKey string
-	log    *log.Logger
+	Http    *Upstream
+	cache   *ReqCache
+	baseUrl string
 }
 
 func NewPixabayApi(cfg *Config, cache *ReqCache) PixabayApi {
 	api := PixabayApi{
-		cache:  cache,
-		apiKey: cfg.Pixabay.Key,
-		log:    log.New(os.Stderr, "(pixabay)", log.LstdFlags),
+		Http: NewUpstream("pixabay", cfg.Http.merge(cfg.Pixabay.Http)).WithKeys(cfg.Pixabay.Key,
+			func(req *http.Request, key string) {
+				q := req.URL.Query()
+				q.Set("key", key)
+				req.URL.RawQuery = q.Encode()
+			}),
+		cache:   cache,
+		baseUrl: pixabayBaseUrl,
 	}
 
 	return api
@@ -54,21 +63,26 @@ func (api *PixabayApi) TTL() int {
 
 func (api *PixabayApi) PageSize() int { return 100 }
 
-func (api *PixabayApi) Search(page int, query string) ImageSearchResult {
-	baseUrl := "https://pixabay.com/api/"
+func (api *PixabayApi) Ping(ctx context.Context) error {
+	return pingUrl(ctx, api.Http, api.baseUrl)
+}
+
+const pixabayBaseUrl string = "https://pixabay.com/api/"
+
+func (api *PixabayApi) Search(ctx context.Context, page int, query string) ImageSearchResult {
+	log := logFrom(ctx).With("provider", api.Type())
 	qParam := url.Values{}
-	qParam.Add("key", api.apiKey)
 	qParam.Add("q", query)
 	qParam.Add("page", strconv.Itoa(page))
 	qParam.Add("per_page", strconv.Itoa(api.PageSize()))
-	getReq, err := http.NewRequest(http.MethodGet, baseUrl+"?"+qParam.Encode(), nil)
+	getReq, err := http.NewRequestWithContext(ctx, http.MethodGet, api.baseUrl+"?"+qParam.Encode(), nil)
 	if err != nil {
-		api.log.Println("Failed to create http request:", err.Error())
+		log.Error("Failed to create http request", "err", err)
 		return ImageSearchResult{err: &err, images: []ImageData{}}
 	}
-	req, err := api.cache.CachedFetch(getReq, &api.Http)
+	req, err := api.cache.CachedFetch(getReq, api.Http, api.TTL())
 	if err != nil {
-		api.log.Println("Failed to fetch:", err.Error())
+		log.Error("Failed to fetch", "err", err)
 		return ImageSearchResult{err: &err, images: []ImageData{}}
 	}
 	defer req.Body.Close()
@@ -76,7 +90,7 @@ func (api *PixabayApi) Search(page int, query string) ImageSearchResult {
 	data := PixabaySearchResult{}
 	err = json.NewDecoder(req.Body).Decode(&data)
 	if err != nil {
-		api.log.Println("Failed to decode response", err.Error())
+		log.Error("Failed to decode response", "err", err)
 		return ImageSearchResult{err: &err, images: []ImageData{}}
 	}
 	output := make([]ImageData, len(data.Hits))
@@ -86,9 +100,24 @@ func (api *PixabayApi) Search(page int, query string) ImageSearchResult {
 		output[i].Source = "Pixabay"
 		output[i].SourceUrl = el.PageUrl
 		output[i].Artist = el.User
-		output[i].Aspect = el.WebFormatWidth / el.WebFormatHeight
-		output[i].DownloadUrl = el.ImageUrl
+		output[i].ArtistUrl = pixabayUserUrl(el.User, el.UserId)
+		output[i].Licence = "Pixabay Content License"
+		output[i].LicenceUrl = "https://pixabay.com/service/license-summary/"
+		output[i].setSize(el.ImageWidth, el.ImageHeight)
+		output[i].DownloadUrl = firstNonEmpty(el.ImageUrl, el.LargeImageUrl)
 		output[i].PreviewUrl = el.WebFormatUrl
+		// the original imageURL is only returned to accounts with full API access
+		output[i].Renditions = renditions(
+			fitRendition(el.PreviewUrl, el.PreviewWidth, el.PreviewHeight, 0, 0),
+			fitRendition(el.WebFormatUrl, el.WebFormatWidth, el.WebFormatHeight, 0, 0),
+			fitRendition(el.LargeImageUrl, el.ImageWidth, el.ImageHeight, 1280, 1280),
+			fitRendition(el.ImageUrl, el.ImageWidth, el.ImageHeight, 0, 0),
+		)
 	}
 	return ImageSearchResult{err: nil, images: output}
 }
+
+// pixabayUserUrl is the profile page of a Pixabay user
+func pixabayUserUrl(user string, id int) string {
+	return "https://pixabay.com/users/" + url.PathEscape(user) + "-" + strconv.Itoa(id) + "/"
+}
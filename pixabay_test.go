@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPixabaySearch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "test-key", r.URL.Query().Get("key"))
+		http.ServeFile(w, r, "testdata/pixabay_search.json")
+	}))
+	defer srv.Close()
+
+	cfg := defaultConfig()
+	cfg.Pixabay.Key = KeyList{"test-key"}
+	api := NewPixabayApi(&cfg, newTestCache(t))
+	api.baseUrl = srv.URL
+
+	res := api.Search(context.Background(), 1, "flower")
+	assert.Nil(t, res.err)
+	assert.Equal(t, 1, len(res.images))
+
+	img := res.images[0]
+	assert.Equal(t, "https://pixabay.com/users/Josch13-48777/", img.ArtistUrl)
+	assert.Equal(t, "https://pixabay.com/get/ed6a99fd0a76647_1280.jpg", img.DownloadUrl, "Large image without full API access")
+	assert.Equal(t, 3, len(img.Renditions), "No original without full API access")
+	assert.Equal(t, Rendition{150, 84, "https://cdn.pixabay.com/photo/2013/10/15/09/12/flower-195893_150.jpg"}, img.Renditions[0])
+	assert.Equal(t, Rendition{640, 360, img.PreviewUrl}, img.Renditions[1])
+	assert.Equal(t, Rendition{1280, 720, img.DownloadUrl}, img.Renditions[2])
+}
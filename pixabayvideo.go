@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+type PixabayVideoFile struct {
+	Url       string `json:"url"`
+	Width     int    `json:"width"`
+	Height    int    `json:"height"`
+	Size      int    `json:"size"`
+	Thumbnail string `json:"thumbnail"`
+}
+
+type PixabayVideoItem struct {
+	Id       int                         `json:"id"`
+	PageUrl  string                      `json:"pageURL"`
+	Tags     string                      `json:"tags"`
+	Duration int                         `json:"duration"`
+	Videos   map[string]PixabayVideoFile `json:"videos"`
+	UserId   int                         `json:"user_id"`
+	User     string                      `json:"user"`
+}
+
+type PixabayVideoSearchResult struct {
+	Total     int                `json:"total"`
+	TotalHits int                `json:"totalHits"`
+	Hits      []PixabayVideoItem `json:"hits"`
+}
+
+type PixabayVideoApi struct {
+	Http    *Upstream
+	cache   *ReqCache
+	baseUrl string
+}
+
+func NewPixabayVideoApi(cfg *Config, cache *ReqCache) PixabayVideoApi {
+	return PixabayVideoApi{
+		Http: NewUpstream("pixabay", cfg.Http.merge(cfg.Pixabay.Http)).WithKeys(cfg.Pixabay.Key,
+			func(req *http.Request, key string) {
+				q := req.URL.Query()
+				q.Set("key", key)
+				req.URL.RawQuery = q.Encode()
+			}),
+		cache:   cache,
+		baseUrl: "https://pixabay.com/api/videos/",
+	}
+}
+
+func (api *PixabayVideoApi) Type() string {
+	return "pixabay-video"
+}
+
+func (api *PixabayVideoApi) TTL() int {
+	return 86400
+}
+
+func (api *PixabayVideoApi) PageSize() int { return 100 }
+
+// pixabayVideoPosters lists the renditions to take the poster frame from,
+// largest first
+var pixabayVideoPosters = []string{"large", "medium", "small", "tiny"}
+
+func (api *PixabayVideoApi) Search(ctx context.Context, page int, query string) VideoSearchResult {
+	log := logFrom(ctx).With("provider", api.Type())
+	qParam := url.Values{}
+	qParam.Add("q", query)
+	qParam.Add("page", strconv.Itoa(page))
+	qParam.Add("per_page", strconv.Itoa(api.PageSize()))
+	getReq, err := http.NewRequestWithContext(ctx, http.MethodGet, api.baseUrl+"?"+qParam.Encode(), nil)
+	if err != nil {
+		log.Error("Failed to create http request", "err", err)
+		return VideoSearchResult{err: &err, videos: []VideoData{}}
+	}
+	req, err := api.cache.CachedFetch(getReq, api.Http, api.TTL())
+	if err != nil {
+		log.Error("Failed to fetch", "err", err)
+		return VideoSearchResult{err: &err, videos: []VideoData{}}
+	}
+	defer req.Body.Close()
+
+	data := PixabayVideoSearchResult{}
+	err = json.NewDecoder(req.Body).Decode(&data)
+	if err != nil {
+		log.Error("Failed to decode response", "err", err)
+		return VideoSearchResult{err: &err, videos: []VideoData{}}
+	}
+	output := make([]VideoData, len(data.Hits))
+	for i, el := range data.Hits {
+		output[i].Id = "pixabay/video/" + strconv.Itoa(el.Id)
+		output[i].Name = el.Tags
+		output[i].Source = "Pixabay"
+		output[i].SourceUrl = el.PageUrl
+		output[i].Artist = el.User
+		output[i].ArtistUrl = pixabayUserUrl(el.User, el.UserId)
+		output[i].Duration = el.Duration
+		output[i].Renditions = make([]VideoRendition, 0, len(el.Videos))
+		for quality, file := range el.Videos {
+			if file.Url == "" {
+				continue
+			}
+			output[i].Renditions = append(output[i].Renditions, VideoRendition{
+				Quality:  quality,
+				Width:    file.Width,
+				Height:   file.Height,
+				FileType: "video/mp4",
+				Size:     file.Size,
+				Url:      file.Url,
+			})
+		}
+		sortRenditions(output[i].Renditions)
+		for _, quality := range pixabayVideoPosters {
+			if file, ok := el.Videos[quality]; ok && file.Url != "" {
+				output[i].PosterUrl = file.Thumbnail
+				if file.Height > 0 {
+					output[i].Aspect = float32(file.Width) / float32(file.Height)
+				}
+				break
+			}
+		}
+	}
+	return VideoSearchResult{err: nil, videos: output}
+}
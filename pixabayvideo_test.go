@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPixabayVideoSearch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "test-key", r.URL.Query().Get("key"))
+		assert.Equal(t, "flowers", r.URL.Query().Get("q"))
+		http.ServeFile(w, r, "testdata/pixabay_videos.json")
+	}))
+	defer srv.Close()
+
+	cfg := defaultConfig()
+	cfg.Pixabay.Key = KeyList{"test-key"}
+	api := NewPixabayVideoApi(&cfg, newTestCache(t))
+	api.baseUrl = srv.URL
+
+	res := api.Search(context.Background(), 1, "flowers")
+	assert.Nil(t, res.err)
+	assert.Equal(t, 1, len(res.videos))
+
+	video := res.videos[0]
+	assert.Equal(t, "pixabay/video/125", video.Id)
+	assert.Equal(t, "flowers, yellow, blossom", video.Name)
+	assert.Equal(t, 12, video.Duration)
+	assert.Equal(t, "https://pixabay.com/users/Coverr-Free-Footage-1281706/", video.ArtistUrl)
+	assert.Equal(t, "https://cdn.pixabay.com/video/125/medium.jpg", video.PosterUrl, "Poster from the largest available rendition")
+	assert.Equal(t, float32(1280)/float32(720), video.Aspect)
+	assert.Equal(t, 2, len(video.Renditions), "Missing renditions are skipped")
+	assert.Equal(t, "small", video.Renditions[0].Quality)
+	assert.Equal(t, "medium", video.Renditions[1].Quality)
+	assert.Equal(t, 2000000, video.Renditions[1].Size)
+}
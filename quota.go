@@ -0,0 +1,166 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Quota is the rate limit state last reported by a provider for one API key
+type Quota struct {
+	Limit     int       `json:"limit"`
+	Remaining int       `json:"remaining"`
+	Reset     time.Time `json:"reset"`
+	Updated   time.Time `json:"updated"`
+}
+
+type QuotaStatus struct {
+	Provider  string `json:"provider"`
+	Key       string `json:"key"`
+	Exhausted bool   `json:"exhausted"`
+	Quota
+}
+
+// QuotaError is returned instead of calling a provider whose key is close to
+// running out of quota
+type QuotaError struct {
+	Provider string
+	Reset    time.Time
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("%s quota exhausted until %s", e.Provider, e.Reset.Format(time.RFC3339))
+}
+
+type quotaKey struct {
+	provider string
+	key      string
+}
+
+type QuotaTracker struct {
+	mu       sync.Mutex
+	quotas   map[quotaKey]*Quota
+	reserves map[string]int
+}
+
+// quotas is shared by every Upstream so the admin endpoint can list them all
+var quotas = NewQuotaTracker()
+
+func NewQuotaTracker() *QuotaTracker {
+	return &QuotaTracker{quotas: map[quotaKey]*Quota{}, reserves: map[string]int{}}
+}
+
+// SetReserve sets how many calls are held back for a provider, once a key is
+// down to its reserve the provider is skipped until the quota resets
+func (qt *QuotaTracker) SetReserve(provider string, reserve int) {
+	qt.mu.Lock()
+	defer qt.mu.Unlock()
+	qt.reserves[provider] = reserve
+}
+
+// keyId identifies an API key in logs and the admin endpoint without
+// revealing it
+func keyId(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:4])
+}
+
+// quotaWindow is assumed when a provider does not say when its quota resets,
+// Unsplash only sends the limit and remaining count for its hourly window
+const quotaWindow = time.Hour
+
+// Update reads the X-Ratelimit headers from a provider response. Pexels sends
+// the reset as a unix timestamp and Pixabay as seconds from now
+func (qt *QuotaTracker) Update(provider string, key string, res *http.Response) {
+	h := res.Header
+	remaining, err := strconv.Atoi(h.Get("X-Ratelimit-Remaining"))
+	if err != nil {
+		if res.StatusCode != http.StatusTooManyRequests {
+			return
+		}
+		remaining = 0
+	}
+	now := time.Now()
+	q := Quota{Remaining: remaining, Updated: now, Reset: now.Add(quotaWindow)}
+	q.Limit, _ = strconv.Atoi(h.Get("X-Ratelimit-Limit"))
+	if reset, err := strconv.ParseInt(h.Get("X-Ratelimit-Reset"), 10, 64); err == nil {
+		if reset > 1e9 {
+			q.Reset = time.Unix(reset, 0)
+		} else {
+			q.Reset = now.Add(time.Duration(reset) * time.Second)
+		}
+	} else if wait, ok := retryAfter(h.Get("Retry-After")); ok {
+		q.Reset = now.Add(wait)
+	}
+
+	qt.mu.Lock()
+	defer qt.mu.Unlock()
+	qt.quotas[quotaKey{provider, key}] = &q
+}
+
+func (qt *QuotaTracker) Get(provider string, key string) (Quota, bool) {
+	qt.mu.Lock()
+	defer qt.mu.Unlock()
+	q, ok := qt.quotas[quotaKey{provider, key}]
+	if !ok {
+		return Quota{}, false
+	}
+	return *q, true
+}
+
+// Exhausted reports whether the key is down to its reserve, and when the quota
+// will reset
+func (qt *QuotaTracker) Exhausted(provider string, key string) (time.Time, bool) {
+	qt.mu.Lock()
+	defer qt.mu.Unlock()
+	q, ok := qt.quotas[quotaKey{provider, key}]
+	if !ok {
+		return time.Time{}, false
+	}
+	return q.Reset, q.exhausted(qt.reserves[provider])
+}
+
+func (q *Quota) exhausted(reserve int) bool {
+	return time.Now().Before(q.Reset) && q.Remaining <= reserve
+}
+
+func (qt *QuotaTracker) Snapshot() []QuotaStatus {
+	qt.mu.Lock()
+	list := make([]QuotaStatus, 0, len(qt.quotas))
+	for k, q := range qt.quotas {
+		list = append(list, QuotaStatus{
+			Provider:  k.provider,
+			Key:       keyId(k.key),
+			Exhausted: q.exhausted(qt.reserves[k.provider]),
+			Quota:     *q,
+		})
+	}
+	qt.mu.Unlock()
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Provider != list[j].Provider {
+			return list[i].Provider < list[j].Provider
+		}
+		return list[i].Key < list[j].Key
+	})
+	return list
+}
+
+// Revoke marks a key the provider rejected as unusable for a quota window
+func (qt *QuotaTracker) Revoke(provider string, key string) {
+	now := time.Now()
+	qt.mu.Lock()
+	defer qt.mu.Unlock()
+	qt.quotas[quotaKey{provider, key}] = &Quota{Remaining: 0, Reset: now.Add(quotaWindow), Updated: now}
+}
+
+// quotaHandler lists the current quota for every provider and key
+func quotaHandler(cfg *Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJson(w, cfg, http.StatusOK, quotas.Snapshot())
+	}
+}
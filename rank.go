@@ -0,0 +1,174 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Ranking strategies, chosen by search.rank or the rank query parameter
+const (
+	rankRoundRobin  string = "roundrobin"
+	rankWeighted    string = "weighted"
+	rankKeyword     string = "keyword"
+	rankOrientation string = "orientation"
+)
+
+var rankStrategies = map[string]bool{
+	rankRoundRobin: true, rankWeighted: true, rankKeyword: true, rankOrientation: true,
+}
+
+// Weight of a query word matching a tag, a whole word or the start of a word,
+// used by keyword ranking and the local library search
+const (
+	matchTagWeight    int = 3
+	matchWordWeight   int = 2
+	matchPrefixWeight int = 1
+)
+
+// matchWords splits text into lower case words for matching
+func matchWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// Orientations accepted by the orientation query parameter
+const (
+	orientationLandscape string = "landscape"
+	orientationPortrait  string = "portrait"
+	orientationSquare    string = "square"
+)
+
+// squareTolerance is how far from 1 an aspect may be and still count as square
+const squareTolerance float32 = 0.05
+
+// Ranking orders the results of one page. Results are scored by the strategy
+// and ties are left in round-robin order
+type Ranking struct {
+	Strategy    string
+	Weights     map[string]float64
+	Query       string
+	Orientation string
+}
+
+// Rankable is implemented by results that can be ranked by their content
+type Rankable interface {
+	rankText() string
+	rankAspect() float32
+}
+
+func (img ImageData) rankText() string    { return img.Name }
+func (img ImageData) rankAspect() float32 { return img.Aspect }
+func (vid VideoData) rankText() string    { return vid.Name }
+func (vid VideoData) rankAspect() float32 { return vid.Aspect }
+
+type rankEntry[T any] struct {
+	item      T
+	preferred bool
+	score     float64
+}
+
+// Ranked lists the results of the page ordered by rank, results of preferred
+// providers are still listed first
+func (p *SearchPages[T]) Ranked(rank Ranking) []T {
+	n := len(p.preferred)
+	entries := make([]rankEntry[T], 0, len(p.Slots))
+	add := func(slot int) {
+		num, pos := slot%n, slot/n
+		entries = append(entries, rankEntry[T]{
+			item:      p.Slots[slot],
+			preferred: p.preferred[num],
+			score:     rank.score(p.types[num], pos, p.Slots[slot]),
+		})
+	}
+	for num := 0; num < n; num++ {
+		if !p.preferred[num] {
+			continue
+		}
+		for slot := num; slot < len(p.Slots); slot += n {
+			if p.filled[slot] {
+				add(slot)
+			}
+		}
+	}
+	for slot := range p.Slots {
+		if p.filled[slot] && !p.preferred[slot%n] {
+			add(slot)
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].preferred != entries[j].preferred {
+			return entries[i].preferred
+		}
+		return entries[i].score > entries[j].score
+	})
+	out := make([]T, len(entries))
+	for i, entry := range entries {
+		out[i] = entry.item
+	}
+	return out
+}
+
+// score is how highly to rank item, the pos'th result from provider
+func (rank *Ranking) score(provider string, pos int, item any) float64 {
+	switch rank.Strategy {
+	case rankWeighted:
+		// a provider with twice the weight has its results placed twice as
+		// often, weights default to 1
+		weight, ok := rank.Weights[provider]
+		if !ok {
+			weight = 1
+		}
+		if weight <= 0 {
+			return math.Inf(-1)
+		}
+		return -float64(pos+1) / weight
+	case rankKeyword:
+		if r, ok := item.(Rankable); ok {
+			return float64(keywordScore(matchWords(rank.Query), r.rankText()))
+		}
+	case rankOrientation:
+		if r, ok := item.(Rankable); ok && hasOrientation(r.rankAspect(), rank.Orientation) {
+			return 1
+		}
+	}
+	return 0
+}
+
+// keywordScore counts the query words found in text, a whole word scores
+// more than a word starting with the query word
+func keywordScore(terms []string, text string) int {
+	words := matchWords(text)
+	score := 0
+	for _, term := range terms {
+		best := 0
+		for _, word := range words {
+			if word == term {
+				best = matchWordWeight
+				break
+			}
+			if len(term) >= 3 && strings.HasPrefix(word, term) {
+				best = matchPrefixWeight
+			}
+		}
+		score += best
+	}
+	return score
+}
+
+func hasOrientation(aspect float32, orientation string) bool {
+	if aspect <= 0 {
+		return false
+	}
+	switch orientation {
+	case orientationLandscape:
+		return aspect > 1+squareTolerance
+	case orientationPortrait:
+		return aspect < 1-squareTolerance
+	case orientationSquare:
+		return aspect >= 1-squareTolerance && aspect <= 1+squareTolerance
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRankWeighted(t *testing.T) {
+	cfg := defaultConfig()
+	apis := []*fakeSearcher{
+		{name: "pixabay", pageSize: 10, total: 4},
+		{name: "unsplash", pageSize: 10, total: 4},
+		{name: "lib", pageSize: 10, total: 1, preferred: true},
+	}
+	res := searchAll(context.Background(), &QueryParams{Page: 1}, apis, NewBreakers(&cfg, apis), fakeSearch)
+
+	assert.Equal(t, []string{"lib0", "pixabay0", "unsplash0", "pixabay1", "unsplash1", "pixabay2", "unsplash2", "pixabay3", "unsplash3"},
+		res.Ranked(Ranking{Strategy: rankRoundRobin}))
+	assert.Equal(t, []string{"lib0", "unsplash0", "pixabay0", "unsplash1", "unsplash2", "pixabay1", "unsplash3", "pixabay2", "pixabay3"},
+		res.Ranked(Ranking{Strategy: rankWeighted, Weights: map[string]float64{"unsplash": 2}}),
+		"Twice the weight places twice as many results")
+	assert.Equal(t, []string{"lib0", "unsplash0", "unsplash1", "unsplash2", "unsplash3", "pixabay0", "pixabay1", "pixabay2", "pixabay3"},
+		res.Ranked(Ranking{Strategy: rankWeighted, Weights: map[string]float64{"pixabay": 0}}),
+		"Zero weight places results last")
+	assert.Equal(t, res.Results(), res.Ranked(Ranking{Strategy: rankKeyword}), "Results without text keep their order")
+}
+
+func TestRankContent(t *testing.T) {
+	images := []ImageData{
+		{Id: "a/1", Name: "city, night", Aspect: 1.5},
+		{Id: "b/1", Name: "red car, street", Aspect: 0.66},
+		{Id: "a/2", Name: "cars", Aspect: 1},
+		{Id: "b/2", Name: "street, red", Aspect: 0.75},
+	}
+	res := &SearchPages[ImageData]{
+		Slots:     images,
+		filled:    []bool{true, true, true, true},
+		preferred: []bool{false, false},
+		types:     []string{"a", "b"},
+	}
+	ids := func(images []ImageData) []string {
+		out := make([]string, len(images))
+		for i, img := range images {
+			out[i] = img.Id
+		}
+		return out
+	}
+	assert.Equal(t, []string{"b/1", "b/2", "a/2", "a/1"}, ids(res.Ranked(Ranking{Strategy: rankKeyword, Query: "red car"})),
+		"Whole words rank above prefixes")
+	assert.Equal(t, []string{"b/1", "b/2", "a/1", "a/2"}, ids(res.Ranked(Ranking{Strategy: rankOrientation, Orientation: orientationPortrait})))
+	assert.Equal(t, []string{"a/2", "a/1", "b/1", "b/2"}, ids(res.Ranked(Ranking{Strategy: rankOrientation, Orientation: orientationSquare})))
+}
+
+func TestParseURL(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.Search.Rank = rankWeighted
+	parse := func(query string) (*QueryParams, error) {
+		u, _ := url.Parse("/search?" + query)
+		return parseURL(&cfg, u)
+	}
+	p, err := parse("q=cat")
+	assert.NoError(t, err)
+	assert.Equal(t, rankWeighted, p.Rank.Strategy, "Configured strategy by default")
+	p, _ = parse("q=cat&orientation=portrait")
+	assert.Equal(t, rankOrientation, p.Rank.Strategy, "Orientation implies the orientation strategy")
+	p, _ = parse("q=cat&rank=keyword")
+	assert.Equal(t, rankKeyword, p.Rank.Strategy)
+	assert.Equal(t, "cat", p.Rank.Query)
+	_, err = parse("q=cat&rank=random")
+	assert.Error(t, err)
+	_, err = parse("q=cat&orientation=round")
+	assert.Error(t, err)
+
+	p, _ = parse("q=cat&sources=pexels,%20unsplash&sources=flickr&exclude=pixabay")
+	assert.Equal(t, []string{"pexels", "unsplash", "flickr"}, p.Sources)
+	assert.Equal(t, []string{"pixabay"}, p.Exclude)
+
+	p, _ = parse("q=cat")
+	assert.Equal(t, PageSize, p.pageSize())
+	p, _ = parse("q=cat&per_page=12")
+	assert.Equal(t, 12, p.pageSize())
+	p, _ = parse("q=cat&per_page=1000")
+	assert.Equal(t, cfg.Search.MaxPerPage, p.pageSize(), "Limited to search.maxPerPage")
+	_, err = parse("q=cat&per_page=0")
+	assert.Error(t, err)
+}
@@ -5,60 +5,118 @@ import (
 	"bytes"
 	"crypto/md5"
 	"encoding/hex"
+	"encoding/json"
 	_ "github.com/mattn/go-sqlite3"
-	"log"
 	"net/http"
 	"net/http/httputil"
-	"os"
+	"sync"
 	"time"
 )
 
 type ReqCache struct {
 	store *Store
-	log   *log.Logger
+	done  chan struct{}
 }
 
 func NewReqCache(cfg *Config, store *Store) *ReqCache {
-	logger := log.New(os.Stderr, "(cache) ", log.LstdFlags)
 	rc := ReqCache{
 		store: store,
-		log:   logger,
+		done:  make(chan struct{}),
 	}
 	go rc.purgeExpired()
 	return &rc
 }
 
 func (rc *ReqCache) purgeExpired() {
+	ticker := time.NewTicker(1 * time.Hour)
+	defer ticker.Stop()
 	for {
 		expiry := time.Now().Unix()
 		rc.store.DeleteBefore(expiry)
-		time.Sleep(1 * time.Hour)
+		select {
+		case <-rc.done:
+			return
+		case <-ticker.C:
+		}
 	}
 }
 
-func (rc *ReqCache) CachedFetch(req *http.Request, client *http.Client) (*http.Response, error) {
+// Close stops the background purge of expired responses
+func (rc *ReqCache) Close() {
+	close(rc.done)
+}
+
+// CachedFetch returns a cached response for req, or fetches and caches it for
+// ttl seconds. The request id is only added to the upstream request after hashing so it does not
+// defeat the cache
+func (rc *ReqCache) CachedFetch(req *http.Request, client *Upstream, ttl int) (*http.Response, error) {
+	log := logFrom(req.Context()).With("component", "cache")
 	reqBytes, _ := httputil.DumpRequest(req, true)
 	md5Hash := md5.Sum(reqBytes)
 	reqHash := hex.EncodeToString(md5Hash[:])
-	data, ok := rc.store.GetResponse(reqHash)
-	if ok {
+	data, expiry, ok := rc.store.GetResponse(reqHash)
+	if ok && expiry < time.Now().Unix() {
+		cacheLookups.WithLabelValues("stale").Inc()
+	} else if ok {
 		res, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(data)), req)
 		if err == nil {
+			cacheLookups.WithLabelValues("hit").Inc()
 			return res, nil
 		} else {
-			rc.log.Println("Problems decoding cached result", err.Error())
+			log.Warn("Problems decoding cached result", "err", err)
+			cacheLookups.WithLabelValues("miss").Inc()
 		}
+	} else {
+		cacheLookups.WithLabelValues("miss").Inc()
 	}
 
+	if id := requestIdFrom(req.Context()); id != "" {
+		req.Header.Set(requestIdHeader, id)
+	}
+	start := time.Now()
 	resp, err := client.Do(req)
 	if err != nil {
 		return nil, err
 	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		resp.Body.Close()
+		log.Warn("Upstream error", "host", req.URL.Host, "status", resp.StatusCode, "duration", time.Since(start))
+		return nil, &StatusError{Provider: client.name, Code: resp.StatusCode, Status: resp.Status}
+	}
 	respBytes, err := httputil.DumpResponse(resp, true)
 	if err != nil {
 		return nil, err
 	}
-	rc.log.Println("MISS", req.URL.Host)
-	rc.store.StoreResponse(reqHash, respBytes, time.Now().Unix()+86400)
+	log.Info("MISS", "host", req.URL.Host, "status", resp.StatusCode, "duration", time.Since(start))
+	rc.store.StoreResponse(reqHash, respBytes, time.Now().Unix()+int64(ttl))
 	return http.ReadResponse(bufio.NewReader(bytes.NewReader(respBytes)), req)
 }
+
+// CachedFetchAll fetches each request through the cache, with at most as many
+// in flight as there is room for in sem, and decodes the JSON responses into the matching element of the
+// result. It is used by providers that search for ids and then need a detail
+// request for each result
+func CachedFetchAll[T any](rc *ReqCache, reqs []*http.Request, client *Upstream, ttl int, sem chan struct{}) ([]T, []error) {
+	out := make([]T, len(reqs))
+	errs := make([]error, len(reqs))
+	var wg sync.WaitGroup
+	for i, req := range reqs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, req *http.Request) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			res, err := rc.CachedFetch(req, client, ttl)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			defer res.Body.Close()
+			errs[i] = json.NewDecoder(res.Body).Decode(&out[i])
+		}(i, req)
+	}
+	wg.Wait()
+	return out, errs
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestCache returns a request cache backed by a temporary database
+func newTestCache(t *testing.T) *ReqCache {
+	cfg := defaultConfig()
+	cfg.Database = filepath.Join(t.TempDir(), "cache.db")
+	store := NewStore(&cfg)
+	cache := NewReqCache(&cfg, store)
+	t.Cleanup(func() {
+		cache.Close()
+		store.Close()
+	})
+	return cache
+}
+
+func TestCachedFetch(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.URL.Query().Get("fail") != "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte("cached body"))
+	}))
+	defer srv.Close()
+
+	cache := newTestCache(t)
+	client := NewUpstream("test", HttpConfig{Timeout: Duration(time.Second)})
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+		res, err := cache.CachedFetch(req, client, 86400)
+		assert.NoError(t, err)
+		body, _ := io.ReadAll(res.Body)
+		assert.Equal(t, "cached body", string(body))
+	}
+	assert.Equal(t, 1, calls, "Second fetch is served from the cache")
+
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"?fail=1", nil)
+		_, err := cache.CachedFetch(req, client, 86400)
+		var statusErr *StatusError
+		assert.ErrorAs(t, err, &statusErr)
+	}
+	assert.Equal(t, 3, calls, "Errors are not cached")
+
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"?expired=1", nil)
+		_, err := cache.CachedFetch(req, client, -1)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 5, calls, "Responses are kept for the ttl")
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+type RijksArtObject struct {
+	Id                    string `json:"id"`
+	ObjectNumber          string `json:"objectNumber"`
+	Title                 string `json:"title"`
+	LongTitle             string `json:"longTitle"`
+	PrincipalOrFirstMaker string `json:"principalOrFirstMaker"`
+	PermitDownload        bool   `json:"permitDownload"`
+	Links                 struct {
+		Web string `json:"web"`
+	} `json:"links"`
+	WebImage *struct {
+		Width  float32 `json:"width"`
+		Height float32 `json:"height"`
+		Url    string  `json:"url"`
+	} `json:"webImage"`
+}
+
+type RijksSearchResult struct {
+	Count      int              `json:"count"`
+	ArtObjects []RijksArtObject `json:"artObjects"`
+}
+
+// RijksApi searches the Rijksmuseum collection, only objects the museum
+// permits downloading (public domain) are returned
+type RijksApi struct {
+	Http    *Upstream
+	cache   *ReqCache
+	baseUrl string
+}
+
+func NewRijksApi(cfg *Config, cache *ReqCache) RijksApi {
+	return RijksApi{
+		Http: NewUpstream("rijksmuseum", cfg.Http.merge(cfg.Rijksmuseum.Http)).WithKeys(cfg.Rijksmuseum.Key,
+			func(req *http.Request, key string) {
+				q := req.URL.Query()
+				q.Set("key", key)
+				req.URL.RawQuery = q.Encode()
+			}),
+		cache:   cache,
+		baseUrl: "https://www.rijksmuseum.nl/api/en/collection",
+	}
+}
+
+func (api *RijksApi) Type() string {
+	return "rijksmuseum"
+}
+
+func (api *RijksApi) TTL() int {
+	return 86400
+}
+
+func (api *RijksApi) PageSize() int { return 100 }
+
+func (api *RijksApi) Ping(ctx context.Context) error {
+	return pingUrl(ctx, api.Http, api.baseUrl)
+}
+
+func (api *RijksApi) Search(ctx context.Context, page int, query string) ImageSearchResult {
+	log := logFrom(ctx).With("provider", api.Type())
+	// the collection API only returns the first 10,000 results
+	if page*api.PageSize() > 10000 {
+		return ImageSearchResult{err: nil, images: []ImageData{}}
+	}
+	qParam := url.Values{}
+	qParam.Add("q", query)
+	qParam.Add("imgonly", "true")
+	qParam.Add("p", strconv.Itoa(page))
+	qParam.Add("ps", strconv.Itoa(api.PageSize()))
+	getReq, err := http.NewRequestWithContext(ctx, http.MethodGet, api.baseUrl+"?"+qParam.Encode(), nil)
+	if err != nil {
+		log.Error("Failed to create http request", "err", err)
+		return ImageSearchResult{err: &err, images: []ImageData{}}
+	}
+	req, err := api.cache.CachedFetch(getReq, api.Http, api.TTL())
+	if err != nil {
+		log.Error("Failed to fetch", "err", err)
+		return ImageSearchResult{err: &err, images: []ImageData{}}
+	}
+	defer req.Body.Close()
+
+	data := RijksSearchResult{}
+	err = json.NewDecoder(req.Body).Decode(&data)
+	if err != nil {
+		log.Error("Failed to decode response", "err", err)
+		return ImageSearchResult{err: &err, images: []ImageData{}}
+	}
+	output := make([]ImageData, 0, len(data.ArtObjects))
+	index := make([]int, 0, len(data.ArtObjects))
+	for i, el := range data.ArtObjects {
+		if !el.PermitDownload || el.WebImage == nil || el.WebImage.Url == "" {
+			continue
+		}
+		img := ImageData{
+			Id:          "rijksmuseum/" + el.ObjectNumber,
+			Name:        el.Title,
+			Source:      "Rijksmuseum",
+			SourceUrl:   el.Links.Web,
+			Artist:      el.PrincipalOrFirstMaker,
+			Licence:     "Public Domain Mark 1.0",
+			LicenceUrl:  "https://creativecommons.org/publicdomain/mark/1.0/",
+			PreviewUrl:  el.WebImage.Url,
+			DownloadUrl: el.WebImage.Url,
+		}
+		img.setSize(el.WebImage.Width, el.WebImage.Height)
+		output = append(output, img)
+		index = append(index, i)
+	}
+	return ImageSearchResult{err: nil, images: output, raw: len(data.ArtObjects), index: index}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Searcher is what the search fan out needs from a provider, it is shared by
+// ImageSearcher and VideoSearcher
+type Searcher interface {
+	Type() string
+	PageSize() int
+}
+
+// Found is one page of a provider's results. Providers that drop some of the
+// results on their page, such as those without a usable image, report how
+// many there were in Raw and the position of each kept item in Index, so
+// offsets stay in the provider's own positions. Index is nil when no
+// results were dropped
+type Found[T any] struct {
+	Items []T
+	Raw   int
+	Index []int
+	Err   *error
+}
+
+// size is the number of results on the provider's page
+func (f *Found[T]) size() int {
+	if f.Index == nil {
+		return len(f.Items)
+	}
+	return f.Raw
+}
+
+// position is where item i was on the provider's page
+func (f *Found[T]) position(i int) int {
+	if f.Index == nil {
+		return i
+	}
+	return f.Index[i]
+}
+
+type ApiResult[T any] struct {
+	Found[T]
+	Num   int
+	Page  PageSrc
+	Start int
+}
+
+// SearchPages holds the merged results of one search. Slots has a row per
+// position with a slot for each provider, so results are interleaved
+type SearchPages[T any] struct {
+	Slots     []T
+	filled    []bool
+	preferred []bool
+	types     []string
+	Status    []string
+	Ok        int
+	// Next is the position in each provider's results the following page
+	// starts from, or -1 once the provider has returned all its results
+	Next []int
+}
+
+// searchAll runs the search against every provider whose breaker allows it,
+// fetching as many of the provider's own pages as needed to fill the page.
+// Providers that have not answered when ctx is done are marked as timed out
+func searchAll[S Searcher, T any](ctx context.Context, query *QueryParams, apis []S, breakers Breakers,
+	search func(ctx context.Context, api S, page int) Found[T]) *SearchPages[T] {
+	pending := make([]int, len(apis))
+	errs := make([]error, len(apis))
+	// covered marks the positions of each provider answered, whether or not
+	// the result was kept, and ends is where a provider's results run out
+	covered := make([]bool, len(apis)*query.pageSize())
+	ends := make([]int, len(apis))
+	res := &SearchPages[T]{
+		Slots:     make([]T, len(apis)*query.pageSize()),
+		filled:    make([]bool, len(apis)*query.pageSize()),
+		preferred: make([]bool, len(apis)),
+		types:     make([]string, len(apis)),
+		Status:    make([]string, len(apis)),
+		Next:      make([]int, len(apis)),
+	}
+	for num, api := range apis {
+		ends[num] = -1
+		res.types[num] = api.Type()
+		if p, ok := any(api).(Preferred); ok {
+			res.preferred[num] = p.Preferred()
+		}
+		if !breakers[api.Type()].Allow() {
+			res.Status[num] = statusCircuitOpen
+			continue
+		}
+		pending[num] = len(GetResRange(query.offset(api.Type()), query.pageSize(), api.PageSize()))
+	}
+	var reqCount int
+	for _, n := range pending {
+		reqCount += n
+	}
+	// buffered so searches that finish after the deadline do not block
+	chRes := make(chan ApiResult[T], reqCount)
+
+	for num, api := range apis {
+		if res.Status[num] == statusCircuitOpen {
+			continue
+		}
+		start := 0
+		for _, src := range GetResRange(query.offset(api.Type()), query.pageSize(), api.PageSize()) {
+			api := api
+			src := src
+			num := num
+			s := start
+			go func() {
+				chRes <- ApiResult[T]{
+					Found: timedSearch(ctx, api, src.Page, search),
+					Num:   num,
+					Page:  src,
+					Start: s,
+				}
+			}()
+			start += src.Last - src.First
+		}
+	}
+
+collect:
+	for rq := 0; rq < reqCount; rq++ {
+		var r ApiResult[T]
+		select {
+		case r = <-chRes:
+		case <-ctx.Done():
+			break collect
+		}
+		pending[r.Num] -= 1
+		if r.Err == nil {
+			res.Ok = res.Ok + 1
+		} else {
+			var quotaErr *QuotaError
+			if errors.As(*r.Err, &quotaErr) {
+				res.Status[r.Num] = statusRateLimited
+			} else {
+				res.Status[r.Num] = statusError
+			}
+			errs[r.Num] = *r.Err
+		}
+		for idx, item := range r.Items {
+			pos := r.position(idx)
+			if pos < r.Page.First || pos >= r.Page.Last {
+				continue
+			}
+			slot := (r.Start+pos-r.Page.First)*len(apis) + r.Num
+			res.Slots[slot] = item
+			res.filled[slot] = true
+		}
+		if r.Err == nil {
+			for pos := r.Page.First; pos < min(r.Page.Last, r.size()); pos++ {
+				covered[(r.Start+pos-r.Page.First)*len(apis)+r.Num] = true
+			}
+			// a provider has run out of results when its page is short
+			if r.size() < apis[r.Num].PageSize() {
+				ends[r.Num] = (r.Page.Page-1)*apis[r.Num].PageSize() + r.size()
+			}
+		}
+	}
+	for num, api := range apis {
+		// the next page continues after the positions answered without a
+		// gap, so results missing after an error or timeout are asked for again
+		answered := 0
+		for answered < query.pageSize() && covered[answered*len(apis)+num] {
+			answered++
+		}
+		res.Next[num] = query.offset(api.Type()) + answered
+		if ends[num] >= 0 && res.Next[num] >= ends[num] {
+			res.Next[num] = -1
+		}
+		if res.Status[num] == statusCircuitOpen {
+			continue
+		}
+		if pending[num] > 0 {
+			res.Status[num] = statusTimeout
+			errs[num] = ctx.Err()
+		} else if res.Status[num] == "" {
+			res.Status[num] = statusOk
+		}
+		// the search deadline is chosen by the client, running out of time
+		// says nothing about the provider. Timeouts of the upstream client
+		// itself end before the deadline and still count as failures
+		if ctx.Err() != nil && errors.Is(errs[num], ctx.Err()) {
+			breakers[api.Type()].Cancel()
+			continue
+		}
+		breakers[api.Type()].Record(errs[num])
+	}
+	return res
+}
+
+// Results lists the results of preferred providers first, then the rest
+// interleaved, dropping the slots left empty by providers that returned fewer
+// results than asked for or did not answer before the deadline
+func (p *SearchPages[T]) Results() []T {
+	return p.Ranked(Ranking{Strategy: rankRoundRobin})
+}
+
+const providerStatusHeader string = "X-Provider-Status"
+
+// Provider states reported in the X-Provider-Status header
+const (
+	statusOk          string = "ok"
+	statusError       string = "error"
+	statusTimeout     string = "timeout"
+	statusCircuitOpen string = "circuit-open"
+	statusRateLimited string = "rate-limited"
+)
+
+// selectApis narrows apis to those named in sources, or all of them when it is
+// empty, less those named in exclude
+func selectApis[S Searcher](apis []S, sources []string, exclude []string) ([]S, error) {
+	known := make(map[string]bool, len(apis))
+	for _, api := range apis {
+		known[api.Type()] = true
+	}
+	for _, name := range append(append([]string{}, sources...), exclude...) {
+		if !known[name] {
+			return nil, fmt.Errorf("unknown source %q", name)
+		}
+	}
+	if len(sources) == 0 && len(exclude) == 0 {
+		return apis, nil
+	}
+	active := make([]S, 0, len(apis))
+	for _, api := range apis {
+		if len(sources) > 0 && !slices.Contains(sources, api.Type()) {
+			continue
+		}
+		if slices.Contains(exclude, api.Type()) {
+			continue
+		}
+		active = append(active, api)
+	}
+	if len(active) == 0 {
+		return nil, errors.New("no sources left to search")
+	}
+	return active, nil
+}
+
+func formatProviderStatus[S Searcher](apis []S, status []string) string {
+	parts := make([]string, len(apis))
+	for num, api := range apis {
+		parts[num] = api.Type() + "=" + status[num]
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Preferred is implemented by searchers whose results are listed ahead of the
+// other providers on each page, rather than interleaved with them
+type Preferred interface {
+	Preferred() bool
+}
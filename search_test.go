@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeSearcher struct {
+	name      string
+	pageSize  int
+	total     int
+	preferred bool
+	delay     time.Duration
+	err       error
+	// drop leaves out every drop'th result, like providers that filter
+	drop int
+}
+
+func (f *fakeSearcher) Type() string    { return f.name }
+func (f *fakeSearcher) PageSize() int   { return f.pageSize }
+func (f *fakeSearcher) Preferred() bool { return f.preferred }
+
+func fakeSearch(ctx context.Context, f *fakeSearcher, page int) Found[string] {
+	select {
+	case <-time.After(f.delay):
+	case <-ctx.Done():
+	}
+	if f.err != nil {
+		return Found[string]{Err: &f.err}
+	}
+	found := Found[string]{}
+	if f.drop > 0 {
+		found.Index = []int{}
+	}
+	for i := (page - 1) * f.pageSize; i < min(f.total, page*f.pageSize); i++ {
+		found.Raw++
+		if f.drop > 0 && i%f.drop == f.drop-1 {
+			continue
+		}
+		found.Items = append(found.Items, f.name+strconv.Itoa(i))
+		if f.drop > 0 {
+			found.Index = append(found.Index, found.Raw-1)
+		}
+	}
+	return found
+}
+
+func TestSearchAll(t *testing.T) {
+	cfg := defaultConfig()
+	apis := []*fakeSearcher{
+		{name: "a", pageSize: 10, total: 2},
+		{name: "lib", pageSize: 100, total: 3, preferred: true},
+		{name: "b", pageSize: 7, total: 100},
+		{name: "slow", pageSize: 10, total: 100, delay: time.Second},
+		{name: "bad", pageSize: 10, err: errors.New("boom")},
+	}
+	breakers := NewBreakers(&cfg, apis)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	res := searchAll(ctx, &QueryParams{Page: 1}, apis, breakers, fakeSearch)
+	assert.Equal(t, []string{"ok", "ok", "ok", "timeout", "error"}, res.Status)
+	assert.Equal(t, "a=ok, lib=ok, b=ok, slow=timeout, bad=error", formatProviderStatus(apis, res.Status))
+
+	results := res.Results()
+	assert.Equal(t, 3+2+PageSize, len(results))
+	assert.Equal(t, []string{"lib0", "lib1", "lib2", "a0", "b0", "a1", "b1", "b2"}, results[:8],
+		"Preferred results first, then interleaved")
+	assert.Equal(t, "b24", results[len(results)-1], "Page spans several upstream pages")
+
+	res = searchAll(context.Background(), &QueryParams{Page: 2}, apis[:3], breakers, fakeSearch)
+	assert.Equal(t, PageSize, len(res.Results()), "Only b has a second page")
+	assert.Equal(t, "b25", res.Results()[0])
+}
+
+func TestSelectApis(t *testing.T) {
+	apis := []*fakeSearcher{
+		{name: "pixabay", pageSize: 10, total: 100},
+		{name: "pexels", pageSize: 10, total: 100},
+		{name: "unsplash", pageSize: 10, total: 100},
+	}
+	names := func(apis []*fakeSearcher) []string {
+		var out []string
+		for _, api := range apis {
+			out = append(out, api.name)
+		}
+		return out
+	}
+	active, err := selectApis(apis, nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(active))
+	active, _ = selectApis(apis, []string{"unsplash", "pexels"}, nil)
+	assert.Equal(t, []string{"pexels", "unsplash"}, names(active), "Config order is kept")
+	active, _ = selectApis(apis, nil, []string{"pixabay"})
+	assert.Equal(t, []string{"pexels", "unsplash"}, names(active))
+	active, _ = selectApis(apis, []string{"pixabay", "pexels"}, []string{"pexels"})
+	assert.Equal(t, []string{"pixabay"}, names(active))
+
+	_, err = selectApis(apis, []string{"flickr"}, nil)
+	assert.EqualError(t, err, `unknown source "flickr"`)
+	_, err = selectApis(apis, []string{"pexels"}, []string{"pexels"})
+	assert.Error(t, err)
+
+	cfg := defaultConfig()
+	active, _ = selectApis(apis, []string{"pexels", "unsplash"}, nil)
+	res := searchAll(context.Background(), &QueryParams{Page: 1}, active, NewBreakers(&cfg, apis), fakeSearch)
+	results := res.Results()
+	assert.Equal(t, PageSize*2, len(results), "A full page from each active provider")
+	assert.Equal(t, []string{"pexels0", "unsplash0", "pexels1", "unsplash1"}, results[:4])
+}
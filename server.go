@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/fcgi"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// serve starts every configured listener and blocks until one of them fails or
+// ctx is cancelled. On cancel it keeps serving for the drain delay, while
+// readiness reports stopping, then in-flight requests are drained before it
+// returns
+func serve(ctx context.Context, cfg *ListenConfig, handler http.Handler) error {
+	errs := make(chan error, 3)
+	inflight := &inflight{}
+	handler = inflight.track(handler)
+
+	var servers []*http.Server
+	var fcgiSock net.Listener
+
+	if cfg.Http != "" {
+		srv := &http.Server{Addr: cfg.Http, Handler: handler}
+		servers = append(servers, srv)
+		go func() {
+			slog.Info("Starting HTTP Server", "addr", cfg.Http)
+			errs <- srv.ListenAndServe()
+		}()
+	}
+
+	if cfg.Https.Addr != "" {
+		if cfg.Https.Cert == "" || cfg.Https.Key == "" {
+			return errors.New("https listener needs both a certificate and key file")
+		}
+		srv := &http.Server{Addr: cfg.Https.Addr, Handler: handler}
+		servers = append(servers, srv)
+		go func() {
+			slog.Info("Starting HTTPS Server", "addr", cfg.Https.Addr)
+			errs <- srv.ListenAndServeTLS(cfg.Https.Cert, cfg.Https.Key)
+		}()
+	}
+
+	if cfg.FastCGI.Addr != "" {
+		sock, err := listenFastCGI(cfg)
+		if err != nil {
+			return err
+		}
+		fcgiSock = sock
+		go func() {
+			slog.Info("Starting FastCGI Server", "network", cfg.FastCGI.Network, "addr", cfg.FastCGI.Addr)
+			errs <- fcgi.Serve(sock, handler)
+		}()
+	}
+
+	if len(servers) == 0 && fcgiSock == nil {
+		return errors.New("no listeners configured")
+	}
+
+	var err error
+	select {
+	case err = <-errs:
+	case <-ctx.Done():
+		// load balancers need time to see readiness fail and stop sending
+		// new requests before the listeners close
+		if delay := cfg.DrainDelay.Std(); delay > 0 {
+			slog.Info("Shutting down, waiting for traffic to drain", "delay", delay)
+			select {
+			case err = <-errs:
+			case <-time.After(delay):
+			}
+		}
+		slog.Info("Shutting down, waiting for in-flight requests")
+	}
+
+	shutdown, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout.Std())
+	defer cancel()
+	for _, srv := range servers {
+		srv.Shutdown(shutdown)
+	}
+	if fcgiSock != nil {
+		fcgiSock.Close()
+		if cfg.FastCGI.Network != "tcp" {
+			os.Remove(cfg.FastCGI.Addr)
+		}
+	}
+	if !inflight.wait(shutdown) {
+		slog.Warn("Timed out waiting for in-flight requests")
+	}
+	return err
+}
+
+func listenFastCGI(cfg *ListenConfig) (net.Listener, error) {
+	addr := cfg.FastCGI.Addr
+	switch cfg.FastCGI.Network {
+	case "tcp":
+		return net.Listen("tcp", addr)
+	case "unix", "":
+	default:
+		return nil, fmt.Errorf("unknown fastcgi network %q", cfg.FastCGI.Network)
+	}
+
+	mode, err := strconv.ParseUint(cfg.FastCGI.Mode, 8, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid fastcgi socket mode %q: %w", cfg.FastCGI.Mode, err)
+	}
+	if _, err := os.Stat(addr); os.IsNotExist(err) {
+		os.MkdirAll(filepath.Dir(addr), 0755)
+	} else {
+		os.Remove(addr)
+	}
+	sock, err := net.Listen("unix", addr)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open socket: %w", err)
+	}
+	err = os.Chmod(addr, os.FileMode(mode))
+	if err != nil {
+		sock.Close()
+		return nil, fmt.Errorf("unable to set socket permissions: %w", err)
+	}
+	return sock, nil
+}
+
+// inflight counts requests being served, http.Server.Shutdown drains its own
+// connections but FastCGI has no equivalent
+type inflight struct {
+	count atomic.Int64
+}
+
+func (f *inflight) track(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.count.Add(1)
+		defer f.count.Add(-1)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (f *inflight) wait(ctx context.Context) bool {
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for f.count.Load() > 0 {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+		}
+	}
+	return true
+}
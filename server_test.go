@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServeDrainDelay(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	addr := l.Addr().String()
+	l.Close()
+
+	cfg := defaultConfig()
+	cfg.Listen = ListenConfig{Http: addr, DrainDelay: Duration(300 * time.Millisecond), ShutdownTimeout: Duration(time.Second)}
+	ctx, cancel := context.WithCancel(context.Background())
+	health := NewHealth(ctx, &cfg, newTestCache(t).store, nil, Breakers{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/readyz", health.Ready)
+	done := make(chan error)
+	go func() { done <- serve(ctx, &cfg.Listen, mux) }()
+
+	ready := func() int {
+		res, err := http.Get("http://" + addr + "/readyz")
+		if err != nil {
+			return 0
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+	assert.Eventually(t, func() bool { return ready() == http.StatusOK }, time.Second, 10*time.Millisecond)
+
+	cancel()
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, http.StatusServiceUnavailable, ready(), "Still serving, readiness reports stopping")
+	assert.NoError(t, <-done)
+	assert.Equal(t, 0, ready(), "Listener closed after the delay")
+}
@@ -1,19 +1,20 @@
 package main
 
 import (
+	"context"
 	"crypto/subtle"
 	"database/sql"
 	"errors"
 	"github.com/alexedwards/argon2id"
 	"github.com/apibillme/cache"
-	"log"
-	"os"
+	"log/slog"
+	"strings"
 	"time"
 )
 
 type Store struct {
 	db        *sql.DB
-	log       *log.Logger
+	log       *slog.Logger
 	userCache cache.Cache
 }
 
@@ -33,10 +34,21 @@ const userTable string = `
   )
 `
 
+const imageMetaTable string = `
+  CREATE TABLE IF NOT EXISTS imagemeta (
+      id TEXT NOT NULL PRIMARY KEY,
+      width INT NOT NULL,
+      height INT NOT NULL,
+      color TEXT NOT NULL,
+      blurhash TEXT NOT NULL,
+      dhash TEXT NOT NULL DEFAULT ''
+  )
+`
+
 const dbFile string = "data/cache.db"
 
 func NewStore(cfg *Config) *Store {
-	logger := log.New(os.Stderr, "(store) ", log.LstdFlags)
+	logger := slog.Default().With("component", "store")
 
 	filename := dbFile
 	if cfg.Database != "" {
@@ -51,6 +63,12 @@ func NewStore(cfg *Config) *Store {
 	_, err = db.Exec(userTable)
 	dbError(logger, err)
 
+	_, err = db.Exec(imageMetaTable)
+	dbError(logger, err)
+	// tables created before the dhash column was added, the error when the
+	// column already exists is expected
+	db.Exec("ALTER TABLE imagemeta ADD COLUMN dhash TEXT NOT NULL DEFAULT ''")
+
 	userCache := cache.New(256, cache.WithTTL(1*time.Hour))
 
 	return &Store{
@@ -60,6 +78,16 @@ func NewStore(cfg *Config) *Store {
 	}
 }
 
+// Ping checks the database can still be queried
+func (store *Store) Ping(ctx context.Context) error {
+	var n int
+	return store.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM users").Scan(&n)
+}
+
+func (store *Store) Close() error {
+	return store.db.Close()
+}
+
 func (store *Store) DeleteBefore(expiry int64) {
 	_, err := store.db.Exec("DELETE FROM reqdata WHERE expiry < ?", expiry)
 	if err != nil {
@@ -67,16 +95,28 @@ func (store *Store) DeleteBefore(expiry int64) {
 	}
 }
 
-func (store *Store) GetResponse(hash string) ([]byte, bool) {
-	row := store.db.QueryRow("SELECT httpdata FROM reqdata WHERE hash = ?", hash)
+func (store *Store) GetResponse(hash string) ([]byte, int64, bool) {
+	row := store.db.QueryRow("SELECT httpdata, expiry FROM reqdata WHERE hash = ? ORDER BY expiry DESC LIMIT 1", hash)
 	var data []byte
-	err := row.Scan(&data)
+	var expiry int64
+	err := row.Scan(&data, &expiry)
 	if err == nil {
-		return data, true
-	} else {
-		println("db:", err.Error())
+		return data, expiry, true
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		store.log.Error("Unable to read cached response", "err", err)
+	}
+	return nil, 0, false
+}
+
+// CacheSize returns the number of cached responses and their total size
+func (store *Store) CacheSize() (int64, int64) {
+	row := store.db.QueryRow("SELECT COUNT(*), COALESCE(SUM(LENGTH(httpdata)), 0) FROM reqdata")
+	var entries, size int64
+	err := row.Scan(&entries, &size)
+	if err != nil {
+		store.log.Error("Unable to read cache size", "err", err)
 	}
-	return nil, false
+	return entries, size
 }
 
 func (store *Store) StoreResponse(hash string, res []byte, expiry int64) {
@@ -90,34 +130,101 @@ func (store *Store) StoreResponse(hash string, res []byte, expiry int64) {
 	}
 }
 
+// GetImageMeta returns the computed metadata stored for each of ids, ids
+// without any are left out
+func (store *Store) GetImageMeta(ids []string) map[string]ImageMeta {
+	found := map[string]ImageMeta{}
+	if len(ids) == 0 {
+		return found
+	}
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	rows, err := store.db.Query("SELECT id, width, height, color, blurhash, dhash FROM imagemeta WHERE id IN (?"+
+		strings.Repeat(",?", len(ids)-1)+")", args...)
+	if err != nil {
+		store.log.Error("Unable to read image metadata", "err", err)
+		return found
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id string
+		var meta ImageMeta
+		if err := rows.Scan(&id, &meta.Width, &meta.Height, &meta.Color, &meta.Blurhash, &meta.DHash); err != nil {
+			store.log.Error("Unable to read image metadata", "err", err)
+			return found
+		}
+		found[id] = meta
+	}
+	return found
+}
+
+func (store *Store) StoreImageMeta(id string, meta ImageMeta) {
+	_, err := store.db.Exec("INSERT OR REPLACE INTO imagemeta (id, width, height, color, blurhash, dhash) VALUES (?,?,?,?,?,?)",
+		id,
+		meta.Width,
+		meta.Height,
+		meta.Color,
+		meta.Blurhash,
+		meta.DHash,
+	)
+	if err != nil {
+		store.log.Error("Unable to store image metadata", "err", err)
+	}
+}
+
+// User levels from the users table, admins can also use the /admin endpoints
+const (
+	LevelUser  int = 1
+	LevelAdmin int = 2
+)
+
+type cachedUser struct {
+	pass  string
+	level int
+}
+
 func (store *Store) TestUser(user string, pass string) bool {
-	userPass, ok := store.userCache.Get(user)
-	if ok && 1 == subtle.ConstantTimeCompare([]byte(userPass.(string)), []byte(pass)) {
-		return true
+	_, ok := store.userLevel(user, pass)
+	return ok
+}
+
+func (store *Store) TestAdmin(user string, pass string) bool {
+	level, ok := store.userLevel(user, pass)
+	return ok && level >= LevelAdmin
+}
+
+func (store *Store) userLevel(user string, pass string) (int, bool) {
+	cached, ok := store.userCache.Get(user)
+	if ok && 1 == subtle.ConstantTimeCompare([]byte(cached.(cachedUser).pass), []byte(pass)) {
+		return cached.(cachedUser).level, true
 	}
-	row := store.db.QueryRow("SELECT hash FROM users WHERE user = ?", user)
+	row := store.db.QueryRow("SELECT hash, level FROM users WHERE user = ?", user)
 	//println("User:", user, pass)
 	var hash string
-	err := row.Scan(&hash)
+	var level int
+	err := row.Scan(&hash, &level)
 	if err == nil {
 		//println("Hash: ", hash)
 		match, err := argon2id.ComparePasswordAndHash(pass, hash)
 		if err != nil {
-			store.log.Println("Error comparing password hashes", err.Error())
-			return false
+			store.log.Error("Error comparing password hashes", "err", err)
+			return 0, false
 		}
 		if match {
-			store.userCache.Set(user, pass)
-			return true
+			store.userCache.Set(user, cachedUser{pass: pass, level: level})
+			return level, true
 		}
 	} else if !errors.Is(err, sql.ErrNoRows) {
-		store.log.Println(err.Error())
+		store.log.Error("Unable to read user", "err", err)
 	}
-	return false
+	return 0, false
 }
 
-func dbError(log *log.Logger, err error) {
+func dbError(log *slog.Logger, err error) {
 	if err != nil {
-		log.Panicln("DB Error", err.Error())
+		log.Error("DB Error", "err", err)
+		panic(err)
 	}
 }
@@ -1,11 +1,10 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
-	"log"
 	"net/http"
 	"net/url"
-	"os"
 	"strconv"
 )
 
@@ -14,6 +13,8 @@ type UnsplashPhoto struct {
 	Width       float32            `json:"width"`
 	Height      float32            `json:"height"`
 	Description string             `json:"description"`
+	Color       string             `json:"color"`
+	BlurHash    string             `json:"blur_hash"`
 	User        UnsplashUser       `json:"user"`
 	Urls        UnsplashUrls       `json:"urls"`
 	Links       UnsplashPhotoLinks `json:"links"`
@@ -27,9 +28,10 @@ type UnsplashUser struct {
 }
 
 type UnsplashPhotoLinks struct {
-	Self     string `json:"self"`
-	Html     string `json:"html"`
-	Download string `json:"download"`
+	Self             string `json:"self"`
+	Html             string `json:"html"`
+	Download         string `json:"download"`
+	DownloadLocation string `json:"download_location"`
 }
 
 type UnsplashUserLinks struct {
@@ -40,10 +42,18 @@ type UnsplashUserLinks struct {
 }
 
 type UnsplashUrls struct {
+	Thumb   string `json:"thumb"`
+	Small   string `json:"small"`
 	Regular string `json:"regular"`
+	Full    string `json:"full"`
 	Raw     string `json:"raw"`
 }
 
+// UnsplashDownload is the response from a photo's download_location
+type UnsplashDownload struct {
+	Url string `json:"url"`
+}
+
 type UnsplashSearchResult struct {
 	Total      int             `json:"total"`
 	TotalPages int             `json:"total_pages"`
@@ -51,20 +61,22 @@ type UnsplashSearchResult struct {
 }
 
 type UnsplashApi struct {
-	Http      http.Client
-	cache     *ReqCache
-	accessKey string
-	baseUrl   string
-	log       *log.Logger
+	Http    *Upstream
+	cache   *ReqCache
+	baseUrl string
+	appName string
 }
 
 func NewUnsplashApi(cfg *Config, cache *ReqCache) UnsplashApi {
 
 	return UnsplashApi{
-		cache:     cache,
-		accessKey: cfg.Unsplash.AccessKey,
-		baseUrl:   "https://api.unsplash.com/search/photos",
-		log:       log.New(os.Stderr, "(unsplash)", log.LstdFlags),
+		Http: NewUpstream("unsplash", cfg.Http.merge(cfg.Unsplash.Http)).WithKeys(cfg.Unsplash.AccessKey,
+			func(req *http.Request, key string) {
+				req.Header.Set("Authorization", "Client-ID "+key)
+			}),
+		cache:   cache,
+		baseUrl: "https://api.unsplash.com",
+		appName: cfg.Unsplash.AppName,
 	}
 }
 
@@ -77,21 +89,25 @@ func (unsp *UnsplashApi) TTL() int {
 }
 func (unsp *UnsplashApi) PageSize() int { return 30 }
 
-func (unsp *UnsplashApi) Search(page int, query string) ImageSearchResult {
+func (unsp *UnsplashApi) Ping(ctx context.Context) error {
+	return pingUrl(ctx, unsp.Http, unsp.baseUrl+"/search/photos")
+}
+
+func (unsp *UnsplashApi) Search(ctx context.Context, page int, query string) ImageSearchResult {
+	log := logFrom(ctx).With("provider", unsp.Type())
 	qParam := url.Values{}
 	qParam.Add("query", query)
 	qParam.Add("page", strconv.Itoa(page))
 	qParam.Add("per_page", strconv.Itoa(unsp.PageSize()))
-	getReq, err := http.NewRequest(http.MethodGet, unsp.baseUrl+"?"+qParam.Encode(), nil)
+	getReq, err := http.NewRequestWithContext(ctx, http.MethodGet, unsp.baseUrl+"/search/photos?"+qParam.Encode(), nil)
 	if err != nil {
-		unsp.log.Println("Failed to create http request:", err.Error())
+		log.Error("Failed to create http request", "err", err)
 		return ImageSearchResult{err: &err, images: []ImageData{}}
 	}
 	getReq.Header.Set("Accept-Version", "v1")
-	getReq.Header.Set("Authorization", "Client-ID "+unsp.accessKey)
-	req, err := unsp.cache.CachedFetch(getReq, &unsp.Http)
+	req, err := unsp.cache.CachedFetch(getReq, unsp.Http, unsp.TTL())
 	if err != nil {
-		unsp.log.Println("(unsplash) Failed to fetch:", err.Error())
+		log.Error("Failed to fetch", "err", err)
 		return ImageSearchResult{err: &err, images: []ImageData{}}
 	}
 	defer req.Body.Close()
@@ -99,7 +115,7 @@ func (unsp *UnsplashApi) Search(page int, query string) ImageSearchResult {
 	data := UnsplashSearchResult{}
 	err = json.NewDecoder(req.Body).Decode(&data)
 	if err != nil {
-		unsp.log.Println("Failed to decode response", err.Error())
+		log.Error("Failed to decode response", "err", err)
 		return ImageSearchResult{err: &err, images: []ImageData{}}
 	}
 	output := make([]ImageData, len(data.Results))
@@ -107,11 +123,74 @@ func (unsp *UnsplashApi) Search(page int, query string) ImageSearchResult {
 		output[i].Id = "unsplash/" + el.Id
 		output[i].Name = el.Description
 		output[i].Source = "Unsplash"
-		output[i].SourceUrl = el.Links.Html
+		output[i].SourceUrl = utmUrl(el.Links.Html, unsp.appName)
 		output[i].Artist = el.User.Name
-		output[i].Aspect = el.Width / el.Height
+		output[i].ArtistUrl = utmUrl(el.User.Links.Html, unsp.appName)
+		output[i].Licence = "Unsplash License"
+		output[i].LicenceUrl = "https://unsplash.com/license"
+		output[i].setSize(el.Width, el.Height)
+		output[i].Color = el.Color
+		output[i].Blurhash = el.BlurHash
 		output[i].DownloadUrl = el.Urls.Raw
 		output[i].PreviewUrl = el.Urls.Regular
+		output[i].Renditions = renditions(
+			fitRendition(el.Urls.Thumb, el.Width, el.Height, 200, 0),
+			fitRendition(el.Urls.Small, el.Width, el.Height, 400, 0),
+			fitRendition(el.Urls.Regular, el.Width, el.Height, 1080, 0),
+			fitRendition(el.Urls.Full, el.Width, el.Height, 0, 0),
+		)
+		output[i].UseUrl = useUrl(output[i].Id)
 	}
 	return ImageSearchResult{err: nil, images: output}
 }
+
+// Use triggers the photo's download_location as the Unsplash API guidelines
+// require whenever a photo is used. The photo itself is looked up through the
+// cache, the download is never cached so every use is counted
+func (unsp *UnsplashApi) Use(ctx context.Context, id string) (string, error) {
+	log := logFrom(ctx).With("provider", unsp.Type())
+	getReq, err := http.NewRequestWithContext(ctx, http.MethodGet, unsp.baseUrl+"/photos/"+url.PathEscape(id), nil)
+	if err != nil {
+		return "", err
+	}
+	getReq.Header.Set("Accept-Version", "v1")
+	req, err := unsp.cache.CachedFetch(getReq, unsp.Http, unsp.TTL())
+	if err != nil {
+		log.Error("Failed to fetch", "err", err)
+		return "", err
+	}
+	defer req.Body.Close()
+	photo := UnsplashPhoto{}
+	if err = json.NewDecoder(req.Body).Decode(&photo); err != nil {
+		log.Error("Failed to decode response", "err", err)
+		return "", err
+	}
+	if photo.Links.DownloadLocation == "" {
+		return "", &StatusError{Provider: unsp.Type(), Code: http.StatusNotFound, Status: "404 No download location"}
+	}
+
+	dlReq, err := http.NewRequestWithContext(ctx, http.MethodGet, photo.Links.DownloadLocation, nil)
+	if err != nil {
+		return "", err
+	}
+	dlReq.Header.Set("Accept-Version", "v1")
+	if id := requestIdFrom(ctx); id != "" {
+		dlReq.Header.Set(requestIdHeader, id)
+	}
+	resp, err := unsp.Http.Do(dlReq)
+	if err != nil {
+		log.Error("Failed to track download", "err", err)
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		log.Error("Failed to track download", "status", resp.StatusCode)
+		return "", &StatusError{Provider: unsp.Type(), Code: resp.StatusCode, Status: resp.Status}
+	}
+	download := UnsplashDownload{}
+	if err = json.NewDecoder(resp.Body).Decode(&download); err != nil {
+		log.Error("Failed to decode response", "err", err)
+		return "", err
+	}
+	return firstNonEmpty(download.Url, photo.Urls.Raw), nil
+}
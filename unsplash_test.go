@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnsplashUse(t *testing.T) {
+	var photoCalls, downloadCalls atomic.Int32
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Client-ID test-key", r.Header.Get("Authorization"))
+		switch r.URL.Path {
+		case "/search/photos":
+			http.ServeFile(w, r, "testdata/unsplash_search.json")
+		case "/photos/Dwu85P9SOIk":
+			photoCalls.Add(1)
+			w.Write([]byte(`{"id": "Dwu85P9SOIk", "links": {"download_location": "` + srv.URL + `/photos/Dwu85P9SOIk/download?ixid=abc"}}`))
+		case "/photos/Dwu85P9SOIk/download":
+			downloadCalls.Add(1)
+			assert.Equal(t, "abc", r.URL.Query().Get("ixid"))
+			w.Write([]byte(`{"url": "https://images.unsplash.com/photo-1417325384643-aac51acc9e5d?ixid=abc"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	cfg := defaultConfig()
+	cfg.Unsplash.AccessKey = KeyList{"test-key"}
+	api := NewUnsplashApi(&cfg, newTestCache(t))
+	api.baseUrl = srv.URL
+
+	res := api.Search(context.Background(), 1, "coffee")
+	assert.Nil(t, res.err)
+	assert.Equal(t, 1, len(res.images))
+	assert.Equal(t, "/use/unsplash/Dwu85P9SOIk", res.images[0].UseUrl)
+	assert.Equal(t, "https://unsplash.com/@exampleuser?utm_medium=referral&utm_source=stockimgproxy", res.images[0].ArtistUrl)
+	assert.Equal(t, "https://unsplash.com/photos/Dwu85P9SOIk?utm_medium=referral&utm_source=stockimgproxy", res.images[0].SourceUrl)
+	assert.Equal(t, "Unsplash License", res.images[0].Licence)
+	assert.Equal(t, "#60544D", res.images[0].Color)
+	assert.Equal(t, "LoC%a7IoIVxZ_NM|M{s:%hRjWAo0", res.images[0].Blurhash)
+	assert.Equal(t, 3000, res.images[0].Width)
+	assert.Equal(t, []Rendition{{1080, 720, res.images[0].PreviewUrl}}, res.images[0].Renditions, "Only sizes with a url")
+
+	handler := useHandler([]ImageSearcher{&api})
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, res.images[0].UseUrl, nil))
+		assert.Equal(t, http.StatusFound, rec.Code)
+		assert.True(t, strings.HasPrefix(rec.Header().Get("Location"), "https://images.unsplash.com/photo-1417325384643"))
+	}
+	assert.Equal(t, int32(1), photoCalls.Load(), "Photo details are cached")
+	assert.Equal(t, int32(2), downloadCalls.Load(), "Every use is tracked")
+
+	for _, path := range []string{"/use/unsplash/missing", "/use/pixabay/123", "/use/unsplash/"} {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, http.StatusNotFound, rec.Code, path)
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// HttpConfig controls how a provider talks to its upstream API, zero values
+// fall back to the global http settings and a negative retries disables retry
+type HttpConfig struct {
+	Timeout        Duration `json:"timeout"`
+	ConnectTimeout Duration `json:"connectTimeout"`
+	Retries        int      `json:"retries"`
+	RetryWait      Duration `json:"retryWait"`
+	RetryMaxWait   Duration `json:"retryMaxWait"`
+	QuotaReserve   int      `json:"quotaReserve"`
+}
+
+func (c HttpConfig) merge(override HttpConfig) HttpConfig {
+	if override.Timeout != 0 {
+		c.Timeout = override.Timeout
+	}
+	if override.ConnectTimeout != 0 {
+		c.ConnectTimeout = override.ConnectTimeout
+	}
+	if override.Retries != 0 {
+		c.Retries = override.Retries
+	}
+	if override.RetryWait != 0 {
+		c.RetryWait = override.RetryWait
+	}
+	if override.RetryMaxWait != 0 {
+		c.RetryMaxWait = override.RetryMaxWait
+	}
+	if override.QuotaReserve != 0 {
+		c.QuotaReserve = override.QuotaReserve
+	}
+	return c
+}
+
+// projectUserAgent identifies the proxy to providers that ask clients to
+// name themselves
+const projectUserAgent string = "stockimgproxy/1.0 (https://github.com/moddengine/stockimgproxy)"
+
+type connectTimeoutKey struct{}
+
+// sharedTransport pools connections for every provider, the connect timeout
+// is carried on the request context so each provider can set its own
+var sharedTransport = &http.Transport{
+	Proxy: http.ProxyFromEnvironment,
+	DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+		timeout, _ := ctx.Value(connectTimeoutKey{}).(time.Duration)
+		dialer := net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second}
+		return dialer.DialContext(ctx, network, addr)
+	},
+	ForceAttemptHTTP2:     true,
+	MaxIdleConns:          100,
+	MaxIdleConnsPerHost:   16,
+	IdleConnTimeout:       90 * time.Second,
+	TLSHandshakeTimeout:   10 * time.Second,
+	ExpectContinueTimeout: 1 * time.Second,
+}
+
+// StatusError is returned for upstream responses that are not a success, they
+// are never cached
+type StatusError struct {
+	Provider string
+	Code     int
+	Status   string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s returned %s", e.Provider, e.Status)
+}
+
+type Upstream struct {
+	name      string
+	cfg       HttpConfig
+	client    http.Client
+	keys      KeyList
+	authorize func(req *http.Request, key string)
+	quotas    *QuotaTracker
+	next      atomic.Uint32
+}
+
+func NewUpstream(name string, cfg HttpConfig) *Upstream {
+	quotas.SetReserve(name, cfg.QuotaReserve)
+	return &Upstream{
+		name:   name,
+		cfg:    cfg,
+		quotas: quotas,
+		client: http.Client{
+			Transport: sharedTransport,
+			Timeout:   cfg.Timeout.Std(),
+		},
+	}
+}
+
+// send makes the request with one API key, retrying idempotent requests on
+// network errors, 429 and gateway errors with jittered exponential backoff.
+// A 429 is not retried when there is another key to fail over to
+func (u *Upstream) send(req *http.Request, key string) (*http.Response, error) {
+	ctx := req.Context()
+	req = req.WithContext(context.WithValue(ctx, connectTimeoutKey{}, u.cfg.ConnectTimeout.Std()))
+	idempotent := req.Method == http.MethodGet || req.Method == http.MethodHead
+
+	for attempt := 0; ; attempt++ {
+		resp, err := u.client.Do(req)
+		if err == nil && key != "" {
+			u.quotas.Update(u.name, key, resp)
+		}
+		if !idempotent || attempt >= u.cfg.Retries || ctx.Err() != nil {
+			return resp, err
+		}
+		wait := u.backoff(attempt)
+		if err == nil {
+			if !retryStatus(resp.StatusCode) {
+				return resp, nil
+			}
+			if resp.StatusCode == http.StatusTooManyRequests && len(u.keys) > 1 {
+				return resp, nil
+			}
+			if after, ok := retryAfter(resp.Header.Get("Retry-After")); ok {
+				if after > u.cfg.RetryMaxWait.Std() {
+					return resp, nil
+				}
+				wait = after
+			}
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+			resp.Body.Close()
+		}
+		logFrom(ctx).Warn("Retrying upstream request", "provider", u.name, "attempt", attempt+1, "wait", wait, "err", err)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// backoff picks a random wait up to the exponential limit for this attempt
+func (u *Upstream) backoff(attempt int) time.Duration {
+	limit := u.cfg.RetryWait.Std() << attempt
+	if limit <= 0 || limit > u.cfg.RetryMaxWait.Std() {
+		limit = u.cfg.RetryMaxWait.Std()
+	}
+	if limit <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(limit)))
+}
+
+func retryStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryAfter reads a Retry-After header given either in seconds or as a date
+func retryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(value); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		wait := time.Until(at)
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+	return 0, false
+}
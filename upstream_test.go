@@ -0,0 +1,125 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testUpstream(retries int) *Upstream {
+	return NewUpstream("test", HttpConfig{
+		Timeout:      Duration(time.Second),
+		Retries:      retries,
+		RetryWait:    Duration(time.Millisecond),
+		RetryMaxWait: Duration(10 * time.Millisecond),
+	})
+}
+
+func TestUpstreamRetry(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	res, err := testUpstream(2).Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, 3, calls)
+
+	calls = 0
+	res, err = testUpstream(-1).Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+	assert.Equal(t, 1, calls)
+}
+
+func TestUpstreamRetryAfter(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Retry-After", "120")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	res, err := testUpstream(2).Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusTooManyRequests, res.StatusCode)
+	assert.Equal(t, 1, calls, "Retry-After beyond the max wait is not retried")
+
+	wait, ok := retryAfter("3")
+	assert.True(t, ok)
+	assert.Equal(t, 3*time.Second, wait)
+	_, ok = retryAfter("soon")
+	assert.False(t, ok)
+}
+
+func TestUpstreamQuota(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("X-Ratelimit-Limit", "50")
+		w.Header().Set("X-Ratelimit-Remaining", "2")
+		w.Header().Set("X-Ratelimit-Reset", "600")
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	qt := NewQuotaTracker()
+	u := testUpstream(0).WithKeys(KeyList{"key-a"}, authHeader).WithQuotas(qt)
+	qt.SetReserve(u.name, 2)
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	_, err := u.Do(req)
+	assert.NoError(t, err)
+
+	q, ok := qt.Get(u.name, "key-a")
+	assert.True(t, ok)
+	assert.Equal(t, 50, q.Limit)
+	assert.Equal(t, 2, q.Remaining)
+	assert.WithinDuration(t, time.Now().Add(10*time.Minute), q.Reset, time.Minute)
+
+	_, err = u.Do(req)
+	var quotaErr *QuotaError
+	assert.ErrorAs(t, err, &quotaErr)
+	assert.Equal(t, 1, calls, "Key at its reserve is not used")
+}
+
+func authHeader(req *http.Request, key string) {
+	req.Header.Set("Authorization", key)
+}
+
+func TestUpstreamKeyFailover(t *testing.T) {
+	used := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Authorization")
+		used[key]++
+		if key == "revoked" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	u := NewUpstream("failover", HttpConfig{Timeout: Duration(time.Second)}).WithKeys(KeyList{"revoked", "good"}, authHeader).WithQuotas(NewQuotaTracker())
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	for i := 0; i < 4; i++ {
+		res, err := u.Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+	}
+	assert.Equal(t, 1, used["revoked"], "Rejected key is not used again")
+	assert.Equal(t, 4, used["good"])
+	assert.Empty(t, req.Header.Get("Authorization"), "Original request is left without credentials")
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"html"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type WikimediaMetaValue struct {
+	Value string `json:"value"`
+}
+
+type WikimediaImageInfo struct {
+	Url            string                        `json:"url"`
+	DescriptionUrl string                        `json:"descriptionurl"`
+	ThumbUrl       string                        `json:"thumburl"`
+	Width          float32                       `json:"width"`
+	Height         float32                       `json:"height"`
+	ExtMetadata    map[string]WikimediaMetaValue `json:"extmetadata"`
+}
+
+type WikimediaPage struct {
+	PageId    int                  `json:"pageid"`
+	Title     string               `json:"title"`
+	Index     int                  `json:"index"`
+	ImageInfo []WikimediaImageInfo `json:"imageinfo"`
+}
+
+type WikimediaSearchResult struct {
+	Query struct {
+		Pages []WikimediaPage `json:"pages"`
+	} `json:"query"`
+}
+
+type WikimediaApi struct {
+	Http      *Upstream
+	cache     *ReqCache
+	baseUrl   string
+	userAgent string
+}
+
+func NewWikimediaApi(cfg *Config, cache *ReqCache) WikimediaApi {
+	// the Wikimedia API policy asks for a user agent with contact details, it
+	// can be given in the configuration
+	userAgent := cfg.Wikimedia.UserAgent
+	if userAgent == "" {
+		userAgent = projectUserAgent
+	}
+	return WikimediaApi{
+		Http:      NewUpstream("wikimedia", cfg.Http.merge(cfg.Wikimedia.Http)),
+		cache:     cache,
+		baseUrl:   "https://commons.wikimedia.org/w/api.php",
+		userAgent: userAgent,
+	}
+}
+
+func (api *WikimediaApi) Type() string {
+	return "wikimedia"
+}
+
+func (api *WikimediaApi) TTL() int {
+	return 86400
+}
+
+// PageSize is the search limit for clients without the apihighlimits right
+func (api *WikimediaApi) PageSize() int { return 50 }
+
+func (api *WikimediaApi) Ping(ctx context.Context) error {
+	return pingUrl(ctx, api.Http, api.baseUrl)
+}
+
+func (api *WikimediaApi) Search(ctx context.Context, page int, query string) ImageSearchResult {
+	log := logFrom(ctx).With("provider", api.Type())
+	qParam := url.Values{}
+	qParam.Add("action", "query")
+	qParam.Add("format", "json")
+	qParam.Add("formatversion", "2")
+	qParam.Add("generator", "search")
+	qParam.Add("gsrsearch", query+" filetype:bitmap")
+	qParam.Add("gsrnamespace", "6")
+	qParam.Add("gsrlimit", strconv.Itoa(api.PageSize()))
+	qParam.Add("gsroffset", strconv.Itoa((page-1)*api.PageSize()))
+	qParam.Add("prop", "imageinfo")
+	qParam.Add("iiprop", "url|size|extmetadata")
+	qParam.Add("iiurlwidth", "640")
+	qParam.Add("iiextmetadatafilter", "Artist|LicenseShortName|LicenseUrl|ObjectName")
+	getReq, err := http.NewRequestWithContext(ctx, http.MethodGet, api.baseUrl+"?"+qParam.Encode(), nil)
+	if err != nil {
+		log.Error("Failed to create http request", "err", err)
+		return ImageSearchResult{err: &err, images: []ImageData{}}
+	}
+	getReq.Header.Set("User-Agent", api.userAgent)
+	req, err := api.cache.CachedFetch(getReq, api.Http, api.TTL())
+	if err != nil {
+		log.Error("Failed to fetch", "err", err)
+		return ImageSearchResult{err: &err, images: []ImageData{}}
+	}
+	defer req.Body.Close()
+
+	data := WikimediaSearchResult{}
+	err = json.NewDecoder(req.Body).Decode(&data)
+	if err != nil {
+		log.Error("Failed to decode response", "err", err)
+		return ImageSearchResult{err: &err, images: []ImageData{}}
+	}
+	// pages are not returned in search order, index holds the search rank
+	pages := data.Query.Pages
+	sort.Slice(pages, func(i, j int) bool { return pages[i].Index < pages[j].Index })
+
+	output := make([]ImageData, 0, len(pages))
+	index := make([]int, 0, len(pages))
+	for i, el := range pages {
+		if len(el.ImageInfo) == 0 {
+			continue
+		}
+		info := el.ImageInfo[0]
+		meta := func(name string) string { return info.ExtMetadata[name].Value }
+		img := ImageData{
+			Id:          "wikimedia/" + strconv.Itoa(el.PageId),
+			Name:        stripHtml(meta("ObjectName")),
+			Source:      "Wikimedia Commons",
+			SourceUrl:   info.DescriptionUrl,
+			Artist:      stripHtml(meta("Artist")),
+			ArtistUrl:   firstLink(meta("Artist")),
+			Licence:     meta("LicenseShortName"),
+			LicenceUrl:  meta("LicenseUrl"),
+			DownloadUrl: info.Url,
+			PreviewUrl:  info.ThumbUrl,
+		}
+		if img.Name == "" {
+			title := strings.TrimPrefix(el.Title, "File:")
+			img.Name = strings.TrimSuffix(title, path.Ext(title))
+		}
+		img.setSize(info.Width, info.Height)
+		if img.PreviewUrl == "" {
+			img.PreviewUrl = info.Url
+		}
+		output = append(output, img)
+		index = append(index, i)
+	}
+	return ImageSearchResult{err: nil, images: output, raw: len(pages), index: index}
+}
+
+var htmlTag = regexp.MustCompile(`<[^>]*>`)
+var htmlHref = regexp.MustCompile(`<a\s[^>]*href="([^"]+)"`)
+
+// stripHtml reduces the HTML Commons uses in its metadata to plain text
+func stripHtml(value string) string {
+	text := html.UnescapeString(htmlTag.ReplaceAllString(value, ""))
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// firstLink returns the first link in the HTML, made absolute for links that
+// are relative to Commons
+func firstLink(value string) string {
+	match := htmlHref.FindStringSubmatch(value)
+	if match == nil {
+		return ""
+	}
+	link := html.UnescapeString(match[1])
+	if strings.HasPrefix(link, "//") {
+		return "https:" + link
+	}
+	if strings.HasPrefix(link, "/") {
+		return "https://commons.wikimedia.org" + link
+	}
+	return link
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWikimediaSearch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		assert.Equal(t, "search", q.Get("generator"))
+		assert.Equal(t, "bridge filetype:bitmap", q.Get("gsrsearch"))
+		assert.Equal(t, "50", q.Get("gsroffset"))
+		assert.Equal(t, projectUserAgent, r.Header.Get("User-Agent"))
+		http.ServeFile(w, r, "testdata/wikimedia_search.json")
+	}))
+	defer srv.Close()
+
+	cfg := defaultConfig()
+	api := NewWikimediaApi(&cfg, newTestCache(t))
+	api.baseUrl = srv.URL
+
+	res := api.Search(context.Background(), 2, "bridge")
+	assert.Nil(t, res.err)
+	assert.Equal(t, 2, len(res.images))
+
+	img := res.images[0]
+	assert.Equal(t, "wikimedia/111", img.Id, "Results are in search order")
+	assert.Equal(t, "Tower Bridge, London", img.Name)
+	assert.Equal(t, "Jo & Sam Example", img.Artist)
+	assert.Equal(t, "https://commons.wikimedia.org/wiki/User:Example", img.ArtistUrl)
+	assert.Equal(t, "CC BY-SA 4.0", img.Licence)
+	assert.Equal(t, float32(4)/3, img.Aspect)
+	assert.Contains(t, img.PreviewUrl, "640px-")
+
+	img = res.images[1]
+	assert.Equal(t, "Eiffel Tower from Trocadero", img.Name, "Falls back to the file name")
+	assert.Equal(t, "Public domain", img.Licence)
+	assert.Equal(t, "", img.Artist)
+}